@@ -6,9 +6,11 @@
 package api
 
 import (
-	"Dropbox_REST_Client/assets"
+	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -18,22 +20,22 @@ import (
 )
 
 // AuthorizeApp -calling system browser and load the Dropbox app authorization page
-func AuthorizeApp(auth AppAuthType) error {
+func (c *Client) AuthorizeApp(auth AppAuthType) error {
 	var err error = nil
-	targetUrl := dropboxAuthURI + "?" + paraClientId + auth.AppKey + "&" + paraTokenAccessType + valTokenAccessType +
+	targetUrl := c.Endpoints().AuthURI + "?" + paraClientId + auth.AppKey + "&" + paraTokenAccessType + valTokenAccessType +
 		"&" + paraResponseType + valResponseType
 	err = openURL(targetUrl)
 	return err
 }
 
 // RequestRefreshToken -fetch refresh token after app has been authorized
-func RequestRefreshToken(auth AppAuthType, code string) (string, error) {
+func (c *Client) RequestRefreshToken(ctx context.Context, auth AppAuthType, code string) (string, error) {
 	var r *RefreshTokenType
 	var err error
 	// create base64 encoded auth. key (app key + app secret, separated by ":")
 	authString := base64.StdEncoding.EncodeToString([]byte(auth.AppKey + ":" + auth.AppSecret))
 	var para = RESTParaType{
-		ParaURL:    dropboxAPIURI + endpointAuthToken,
+		ParaURL:    c.apiURL(endpointAuthToken),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
 			{paraContentType, string(valContentTypeURLForm)},
@@ -45,7 +47,7 @@ func RequestRefreshToken(auth AppAuthType, code string) (string, error) {
 		},
 		ParaBody: nil,
 	}
-	r, err = restCall[*RefreshTokenType](para)
+	r, err = restCall[*RefreshTokenType](ctx, c, para)
 	if err != nil {
 		return "", err
 	}
@@ -53,23 +55,25 @@ func RequestRefreshToken(auth AppAuthType, code string) (string, error) {
 }
 
 // GetCurrentUser -get Dropbox user id, needed for user authorization (making api calls)
-func GetCurrentUser() (*UserInfoType, error) {
+func (c *Client) GetCurrentUser(ctx context.Context) (*UserInfoType, error) {
 	var err error
+	var token string
 	var r UserInfoType
-	err = requestAccessToken()
+	token, err = c.requestAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
 	var para = RESTParaType{
-		ParaURL:    dropboxAPIURI + endpointGetCurrentUser,
+		ParaURL:    c.apiURL(endpointGetCurrentUser),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
-			{paraAuthorization, string(valAuthBearer) + accessToken.token},
+			{paraAuthorization, string(valAuthBearer) + token},
 		},
-		ParaForm: url.Values{},
-		ParaBody: nil,
+		ParaForm:       url.Values{},
+		ParaBody:       nil,
+		ParaIdempotent: true,
 	}
-	r, err = restCall[UserInfoType](para)
+	r, err = restCall[UserInfoType](ctx, c, para)
 	if err != nil {
 		return nil, err
 	}
@@ -77,8 +81,12 @@ func GetCurrentUser() (*UserInfoType, error) {
 }
 
 // CurrentUserGetPicture -fetch user account picture
-func CurrentUserGetPicture(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+func (c *Client) CurrentUserGetPicture(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -93,18 +101,25 @@ func CurrentUserGetPicture(url string) ([]byte, error) {
 }
 
 // ListFolders -list folders && list folders continue
-func ListFolders(path string, recursive bool, limit uint32) ([]*FileItemType, error) {
+func (c *Client) ListFolders(ctx context.Context, path string, recursive bool, limit uint32) ([]*FileItemType, error) {
+	return c.listFolders(ctx, path, recursive, false, limit)
+}
+
+// listFolders -list folders, deleted entries are included with the tag DbxDeleted if includeDeleted
+func (c *Client) listFolders(ctx context.Context, path string, recursive bool, includeDeleted bool,
+	limit uint32) ([]*FileItemType, error) {
 	var err error
+	var token string
 	var hasmore = false
 	var cursor string
 	var entries []*FileItemType
-	err = requestAccessToken()
+	token, err = c.requestAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var r, c ItemInfoType
+	var r, cont ItemInfoType
 	var dbxpara = ListFoldersParaType{
-		false,
+		includeDeleted,
 		false,
 		true,
 		true,
@@ -117,16 +132,17 @@ func ListFolders(path string, recursive bool, limit uint32) ([]*FileItemType, er
 		return nil, err
 	}
 	var paraStart = RESTParaType{
-		ParaURL:    dropboxAPIURI + endpointListFolder,
+		ParaURL:    c.apiURL(endpointListFolder),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
-			{paraAuthorization, string(valAuthBearer) + accessToken.token},
+			{paraAuthorization, string(valAuthBearer) + token},
 			{paraContentType, string(valContentTypeJson)},
 		},
-		ParaForm: url.Values{},
-		ParaBody: []byte(jdbxpara),
+		ParaForm:       url.Values{},
+		ParaBody:       []byte(jdbxpara),
+		ParaIdempotent: true,
 	}
-	r, err = restCall[ItemInfoType](paraStart)
+	r, err = restCall[ItemInfoType](ctx, c, paraStart)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +152,7 @@ func ListFolders(path string, recursive bool, limit uint32) ([]*FileItemType, er
 	hasmore = r.HasMore
 	cursor = r.Cursor
 	for hasmore {
-		err = requestAccessToken()
+		token, err = c.requestAccessToken(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -148,33 +164,35 @@ func ListFolders(path string, recursive bool, limit uint32) ([]*FileItemType, er
 			return nil, err
 		}
 		var paraCont = RESTParaType{
-			ParaURL:    dropboxAPIURI + endpointListFolderContinue,
+			ParaURL:    c.apiURL(endpointListFolderContinue),
 			ParaMethod: http.MethodPost,
 			ParaHeader: []KeyValueType{
-				{paraAuthorization, string(valAuthBearer) + accessToken.token},
+				{paraAuthorization, string(valAuthBearer) + token},
 				{paraContentType, string(valContentTypeJson)},
 			},
-			ParaForm: url.Values{},
-			ParaBody: []byte(jdbxcont),
+			ParaForm:       url.Values{},
+			ParaBody:       []byte(jdbxcont),
+			ParaIdempotent: true,
 		}
-		c, err = restCall[ItemInfoType](paraCont)
+		cont, err = restCall[ItemInfoType](ctx, c, paraCont)
 		if err != nil {
 			return nil, err
 		}
-		for _, e := range c.Entries {
+		for _, e := range cont.Entries {
 			entries = append(entries, &e)
 		}
-		hasmore = c.HasMore
-		cursor = c.Cursor
+		hasmore = cont.HasMore
+		cursor = cont.Cursor
 	}
 	return entries, nil
 }
 
 // MoveFiles -move files to destination folder
-func MoveFiles(from, to string) (*FileItemMetadataType, error) {
+func (c *Client) MoveFiles(ctx context.Context, from, to string) (*FileItemMetadataType, error) {
 	var metadata *FileItemMetadataType
 	var err error
-	err = requestAccessToken()
+	var token string
+	token, err = c.requestAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -189,28 +207,86 @@ func MoveFiles(from, to string) (*FileItemMetadataType, error) {
 		return nil, err
 	}
 	var para = RESTParaType{
-		ParaURL:    dropboxAPIURI + endPointFilesMove,
+		ParaURL:    c.apiURL(endPointFilesMove),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
-			{paraAuthorization, string(valAuthBearer) + accessToken.token},
+			{paraAuthorization, string(valAuthBearer) + token},
 			{paraContentType, string(valContentTypeJson)},
 		},
 		ParaForm: url.Values{},
 		ParaBody: []byte(jdbxpara),
 	}
-	metadata, err = restCall[*FileItemMetadataType](para)
+	metadata, err = restCall[*FileItemMetadataType](ctx, c, para)
 	if err != nil {
 		return nil, err
 	}
 	return metadata, nil
 }
 
+// BatchMoveFiles -move files and folders in one async job, items are renamed if their destination exists,
+// the result has an entry for every move in the order given, progress is called while the job runs and may be nil
+func (c *Client) BatchMoveFiles(ctx context.Context, entries []RelocationPathType,
+	progress JobProgressFunc) (*RelocationBatchResultType, error) {
+	return c.relocationBatch(ctx, endPointFilesMoveBatch, endPointFilesMoveBatchCheck, entries, progress)
+}
+
+// relocationBatch -start a copy or move batch and poll its job until it is complete
+func (c *Client) relocationBatch(ctx context.Context, endpoint, checkEndpoint string, entries []RelocationPathType,
+	progress JobProgressFunc) (*RelocationBatchResultType, error) {
+	token, err := c.requestAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jdbxpara, err := anyToJson[RelocationBatchParaType](RelocationBatchParaType{Entries: entries, Autorename: true})
+	if err != nil {
+		return nil, err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endpoint),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraContentType, string(valContentTypeJson)},
+		},
+		ParaForm: url.Values{},
+		ParaBody: []byte(jdbxpara),
+	}
+	return batchJob[*RelocationBatchResultType](ctx, c, para, checkEndpoint, progress)
+}
+
+// GetMetadata -metadata of a file or folder, fails with ErrNotFound if it does not exist
+func (c *Client) GetMetadata(ctx context.Context, path string) (*FileItemType, error) {
+	var err error
+	var token string
+	token, err = c.requestAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jdbxpara, err := anyToJson[FilePathParaType](FilePathParaType{path})
+	if err != nil {
+		return nil, err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endPointGetMetadata),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraContentType, string(valContentTypeJson)},
+		},
+		ParaForm:       url.Values{},
+		ParaBody:       []byte(jdbxpara),
+		ParaIdempotent: true,
+	}
+	return restCall[*FileItemType](ctx, c, para)
+}
+
 // DeleteFile -delete single file
-func DeleteFile(path string) (*FileItemMetadataType, error) {
+func (c *Client) DeleteFile(ctx context.Context, path string) (*FileItemMetadataType, error) {
 	var err error
+	var token string
 	var metadata *FileItemMetadataType
 	var dbxpara FilePathParaType
-	err = requestAccessToken()
+	token, err = c.requestAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -220,30 +296,31 @@ func DeleteFile(path string) (*FileItemMetadataType, error) {
 		return nil, err
 	}
 	var para = RESTParaType{
-		ParaURL:    dropboxAPIURI + endPointFilesDelete,
+		ParaURL:    c.apiURL(endPointFilesDelete),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
-			{paraAuthorization, string(valAuthBearer) + accessToken.token},
+			{paraAuthorization, string(valAuthBearer) + token},
 			{paraContentType, string(valContentTypeJson)},
 		},
 		ParaForm: url.Values{},
 		ParaBody: []byte(jdbxpara),
 	}
-	metadata, err = restCall[*FileItemMetadataType](para)
+	metadata, err = restCall[*FileItemMetadataType](ctx, c, para)
 	if err != nil {
 		return nil, err
 	}
 	return metadata, nil
 }
 
-// BatchDeleteFiles -delete a bunch of files
-func BatchDeleteFiles(path []string) (*FileItemBatchDeletedType, error) {
+// BatchDeleteFiles -delete a bunch of files in one async job, progress is called while the job runs and may be nil
+func (c *Client) BatchDeleteFiles(ctx context.Context, path []string,
+	progress JobProgressFunc) (*FileItemBatchDeletedType, error) {
 	var err error
-	var metadata *FileItemBatchDeletedType
+	var token string
 	var dbxpara DeleteBatchParaType
 	var _path FilePathParaType
 	var para RESTParaType
-	err = requestAccessToken()
+	token, err = c.requestAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -256,122 +333,104 @@ func BatchDeleteFiles(path []string) (*FileItemBatchDeletedType, error) {
 		return nil, err
 	}
 	para = RESTParaType{
-		ParaURL:    dropboxAPIURI + endPointFilesDeleteBatch,
+		ParaURL:    c.apiURL(endPointFilesDeleteBatch),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
-			{paraAuthorization, string(valAuthBearer) + accessToken.token},
+			{paraAuthorization, string(valAuthBearer) + token},
 			{paraContentType, string(valContentTypeJson)},
 		},
 		ParaForm: url.Values{},
 		ParaBody: []byte(jdbxpara),
 	}
-	metadata, err = restCall[*FileItemBatchDeletedType](para)
+	return batchJob[*FileItemBatchDeletedType](ctx, c, para, endPointFilesDeleteBatchCheck, progress)
+}
+
+// UploadFile -upload a file to Dropbox, files larger than the upload chunk size go through an upload session
+func (c *Client) UploadFile(ctx context.Context, path string, payload []byte) (*FileItemType, error) {
+	return c.UploadReader(ctx, path, bytes.NewReader(payload), int64(len(payload)), nil)
+}
+
+// CreateFolder -create new folder in Dropbox, the name is changed if it already exists
+func (c *Client) CreateFolder(ctx context.Context, path string) (*FileItemType, error) {
+	return c.createFolder(ctx, path, true)
+}
+
+// EnsureFolder -create folder in Dropbox unless it already exists, returns nil metadata for an existing folder
+func (c *Client) EnsureFolder(ctx context.Context, path string) (*FileItemType, error) {
+	var dbxerr *DropboxError
+	metadata, err := c.createFolder(ctx, path, false)
+	if errors.As(err, &dbxerr) && dbxerr.HasTag("conflict") && dbxerr.HasTag("folder") {
+		return nil, nil
+	}
+	return metadata, err
+}
+
+// EnsureFolders -create folders in one async job unless they already exist, parents before their children,
+// returns the metadata in the order of paths, nil for an existing folder, progress may be nil
+func (c *Client) EnsureFolders(ctx context.Context, paths []string,
+	progress JobProgressFunc) ([]*FileItemType, error) {
+	token, err := c.requestAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
-	tag := metadata.Tag
-	id := metadata.AsyncJobId
-	var loop = 0
-	for tag == DbxAsyncJobId && id != "" {
-		err = requestAccessToken()
-		if err != nil {
-			return nil, err
-		}
-		// poll async job
-		metadata = nil
-		batchcheck := BatchCheckParaType{"", id}
-		jbatchcheck, err := anyToJson[BatchCheckParaType](batchcheck)
-		if err != nil {
-			return nil, err
-		}
-		para = RESTParaType{
-			ParaURL:    dropboxAPIURI + endPointFilesDeleteBatchCheck,
-			ParaMethod: http.MethodPost,
-			ParaHeader: []KeyValueType{
-				{paraAuthorization, string(valAuthBearer) + accessToken.token},
-				{paraContentType, string(valContentTypeJson)},
-			},
-			ParaForm: url.Values{},
-			ParaBody: []byte(jbatchcheck),
-		}
-		metadata, err = restCall[*FileItemBatchDeletedType](para)
-		if err != nil {
-			return nil, err
-		}
-		switch metadata.Tag {
-		case DbxInProgress:
-			time.Sleep(pollSleepTime * time.Second)
-			loop++
-			if loop > maxJobPolls { // deploy parachute
-				return nil, errors.New(assets.ErrorAsyncJobTimeOut)
-			}
-			break
-		case DbxComplete:
-			id, tag = "", ""
-			break
-		case DbxFailed:
-			return nil, errors.New(assets.ErrorAsyncJobFailed)
-		default:
-			return nil, errors.New(assets.ErrorAsyncJobUnknownStatus)
-		}
-	}
-	return metadata, nil
-}
-
-// UploadFile -upload a single file to Dropbox (max. file size 150MB)
-func UploadFile(path string, payload []byte) (*FileItemType, error) {
-	var err error
-	var para RESTParaType
-	var metadata *FileItemType
-	opts := UploadFileParaType{
-		AutoRename:     false,
-		Path:           path,
-		Mode:           OverWrite,
-		Mute:           false,
-		StrictConflict: false,
-	}
-	jopts, err := anyToJson(opts)
+	jdbxpara, err := anyToJson[CreateFolderBatchParaType](CreateFolderBatchParaType{Paths: paths})
 	if err != nil {
 		return nil, err
 	}
-	para = RESTParaType{
-		ParaURL:    dropboxContentURI + endPointFilesUpload,
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endPointCreateFolderBatch),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
-			{paraAuthorization, string(valAuthBearer) + accessToken.token},
+			{paraAuthorization, string(valAuthBearer) + token},
 			{paraContentType, string(valContentTypeJson)},
-			{paraDbxAPIArg, jopts},
 		},
 		ParaForm: url.Values{},
-		ParaBody: payload,
+		ParaBody: []byte(jdbxpara),
 	}
-	metadata, err = restCall[*FileItemType](para)
+	result, err := batchJob[*CreateFolderBatchResultType](ctx, c, para, endPointCreateFolderBatchCheck, progress)
 	if err != nil {
 		return nil, err
 	}
-	return metadata, nil
+	var failures []error
+	folders := make([]*FileItemType, len(paths))
+	for i, entry := range result.Entries[:min(len(paths), len(result.Entries))] {
+		var dbxerr *DropboxError
+		switch err := entry.Err(); {
+		case err == nil:
+			folders[i] = &entry.Metadata
+			folders[i].Tag = DbxFolder
+		case errors.As(err, &dbxerr) && dbxerr.HasTag("conflict") && dbxerr.HasTag("folder"):
+		default:
+			failures = append(failures, fmt.Errorf("%s: %w", paths[i], err))
+		}
+	}
+	return folders, errors.Join(failures...)
 }
 
-// CreateFolder -create new folder in Dropbox
-func CreateFolder(path string) (*FileItemType, error) {
+func (c *Client) createFolder(ctx context.Context, path string, autorename bool) (*FileItemType, error) {
 	var err error
 	var metadata *FileItemMetadataType
-	var dbxpara = CreateFolderParaType{true, path}
+	var token string
+	token, err = c.requestAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dbxpara = CreateFolderParaType{autorename, path}
 	jdbxpara, err := anyToJson[CreateFolderParaType](dbxpara)
 	if err != nil {
 		return nil, err
 	}
 	var para = RESTParaType{
-		ParaURL:    dropboxAPIURI + endPointCreateFolder,
+		ParaURL:    c.apiURL(endPointCreateFolder),
 		ParaMethod: http.MethodPost,
 		ParaHeader: []KeyValueType{
-			{paraAuthorization, string(valAuthBearer) + accessToken.token},
+			{paraAuthorization, string(valAuthBearer) + token},
 			{paraContentType, string(valContentTypeJson)},
 		},
 		ParaForm: url.Values{},
 		ParaBody: []byte(jdbxpara),
 	}
-	metadata, err = restCall[*FileItemMetadataType](para)
+	metadata, err = restCall[*FileItemMetadataType](ctx, c, para)
 	if err != nil {
 		return nil, err
 	}
@@ -380,35 +439,55 @@ func CreateFolder(path string) (*FileItemType, error) {
 }
 
 // requestAccessToken -checks if the current access token has expired and fetches a new one, if needed,
-// should be called before making any other dropbox api call
-func requestAccessToken() error {
-	var r RefreshTokenType
-	var err error
-	if accessToken.token == "" || (accessToken.fetchedAt+accessToken.expiresIn+threshold) < time.Now().Unix() {
-		// create base64 encoded auth. key (app key + app secret, separated by ":")
-		authString := base64.StdEncoding.EncodeToString([]byte(authkey.AppKey + ":" + authkey.AppSecret))
-		var para = RESTParaType{
-			ParaURL:    dropboxAPIURI + endpointAuthToken,
-			ParaMethod: http.MethodPost,
-			ParaHeader: []KeyValueType{
-				{paraContentType, string(valContentTypeURLForm)},
-				{paraAuthorization, string(valAuthBasic) + authString},
-			},
-			ParaForm: url.Values{
-				paraGrantType:    {valRefreshToken},
-				paraRefreshToken: {refreshToken},
-			},
-			ParaBody: nil,
-		}
-		r, err = restCall[RefreshTokenType](para)
-		if err != nil {
-			return err
-		}
-		accessToken.token = r.AccessToken
-		accessToken.expiresIn = r.ExpiresIn
-		accessToken.fetchedAt = time.Now().Unix()
+// should be called before making any other dropbox api call, returns the valid access token
+func (c *Client) requestAccessToken(ctx context.Context) (string, error) {
+	if token, ok := c.validAccessToken(); ok {
+		return token, nil
+	}
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+	if token, ok := c.validAccessToken(); ok {
+		return token, nil // refreshed by another call meanwhile
+	}
+	c.mutex.Lock()
+	authkey, refreshToken, credentials := c.authkey, c.refreshToken, c.credentials
+	c.mutex.Unlock()
+	// create base64 encoded auth. key (app key + app secret, separated by ":")
+	authString := base64.StdEncoding.EncodeToString([]byte(authkey.AppKey + ":" + authkey.AppSecret))
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endpointAuthToken),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraContentType, string(valContentTypeURLForm)},
+			{paraAuthorization, string(valAuthBasic) + authString},
+		},
+		ParaForm: url.Values{
+			paraGrantType:    {valRefreshToken},
+			paraRefreshToken: {refreshToken},
+		},
+		ParaBody:       nil,
+		ParaIdempotent: true,
 	}
-	return nil
+	r, err := restCall[RefreshTokenType](ctx, c, para)
+	if err != nil {
+		return "", err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.credentials == credentials {
+		c.accessToken = accessTokenType{token: r.AccessToken, expiresIn: r.ExpiresIn, fetchedAt: time.Now().Unix()}
+	}
+	return r.AccessToken, nil
+}
+
+// validAccessToken -the current access token, ok is false if there is none or it is about to expire
+func (c *Client) validAccessToken() (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.accessToken.token == "" || (c.accessToken.fetchedAt+c.accessToken.expiresIn-threshold) < time.Now().Unix() {
+		return "", false
+	}
+	return c.accessToken.token, true
 }
 
 // https://gist.github.com/sevkin/9798d67b2cb9d07cb05f89f14ba682f8
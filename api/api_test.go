@@ -0,0 +1,91 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - access token and test helpers
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/api/dbxtest"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+const endpointToken = "/oauth2/token"
+
+// newTestServer -stand-in server and a client with short retry and poll intervals
+func newTestServer(t *testing.T) (*dbxtest.Server, *api.Client) {
+	t.Helper()
+	s := dbxtest.NewServer()
+	t.Cleanup(s.Close)
+	c := s.NewClient()
+	c.SetRetryPolicy(api.RetryPolicyType{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+	c.SetPollPolicy(api.PollPolicyType{Interval: time.Millisecond, MaxInterval: 5 * time.Millisecond, Factor: 2})
+	return s, c
+}
+
+// testContent -deterministic content of n bytes
+func testContent(n int) []byte {
+	content := make([]byte, n)
+	for i := range content {
+		content[i] = byte((i*31 + 7) % 251)
+	}
+	return content
+}
+
+func TestAccessToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		refreshToken string
+		calls        int // concurrent calls
+		wantErr      error
+		wantRefresh  int // token requests
+	}{
+		{"single call", dbxtest.RefreshToken, 1, nil, 1},
+		{"concurrent calls share one refresh", dbxtest.RefreshToken, 8, nil, 1},
+		{"revoked refresh token", "revoked", 1, api.ErrInvalidAccessToken, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			c.SetConnectionData(api.AppAuthType{AppKey: s.AppKey, AppSecret: s.AppSecret}, tt.refreshToken)
+			var wg sync.WaitGroup
+			errs := make([]error, tt.calls)
+			for i := range tt.calls {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errs[i] = c.GetCurrentUser(context.Background())
+				}()
+			}
+			wg.Wait()
+			for _, err := range errs {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetCurrentUser() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+			if got := s.Calls(endpointToken); got != tt.wantRefresh {
+				t.Errorf("token requests = %d, want %d", got, tt.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestAccessTokenInvalidatedByConnectionData(t *testing.T) {
+	s, c := newTestServer(t)
+	ctx := context.Background()
+	if _, err := c.GetCurrentUser(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.SetConnectionData(api.AppAuthType{AppKey: s.AppKey, AppSecret: s.AppSecret}, s.RefreshToken)
+	if _, err := c.GetCurrentUser(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Calls(endpointToken); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+}
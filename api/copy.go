@@ -0,0 +1,48 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - copying files and folders
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CopyFiles -copy a file or folder, the copy is renamed if the destination exists
+func (c *Client) CopyFiles(ctx context.Context, from, to string) (*FileItemMetadataType, error) {
+	token, err := c.requestAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dbxpara = FilesMoveParaType{
+		false,
+		true,
+		from,
+		to,
+	}
+	jdbxpara, err := anyToJson[FilesMoveParaType](dbxpara)
+	if err != nil {
+		return nil, err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endPointFilesCopy),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraContentType, string(valContentTypeJson)},
+		},
+		ParaForm: url.Values{},
+		ParaBody: []byte(jdbxpara),
+	}
+	return restCall[*FileItemMetadataType](ctx, c, para)
+}
+
+// BatchCopyFiles -copy files and folders in one async job, copies are renamed if their destination exists,
+// the result has an entry for every copy in the order given, progress is called while the job runs and may be nil
+func (c *Client) BatchCopyFiles(ctx context.Context, entries []RelocationPathType,
+	progress JobProgressFunc) (*RelocationBatchResultType, error) {
+	return c.relocationBatch(ctx, endPointFilesCopyBatch, endPointFilesCopyBatchCheck, entries, progress)
+}
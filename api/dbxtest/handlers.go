@@ -0,0 +1,972 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// In-memory Dropbox stand-in server - endpoint handlers
+// ---------------------------------------------------------------------------------------------------------------------
+
+package dbxtest
+
+import (
+	"Dropbox_REST_Client/api"
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	contentTypeJson        = "application/json"
+	contentTypeOctetStream = "application/octet-stream"
+)
+
+// writeJson -200 OK with JSON body
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeRouteError -409 with a Dropbox tagged union error body, tags from outer to inner, e.g. "path", "not_found"
+func writeRouteError(w http.ResponseWriter, tags ...string) {
+	writeUnionError(w, nil, tags...)
+}
+
+// writeUnionError -409 with a Dropbox tagged union error body, fields are added to the innermost union
+func writeUnionError(w http.ResponseWriter, fields map[string]any, tags ...string) {
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error_summary": strings.Join(tags, "/") + "/...",
+		"error":         unionOf(fields, tags...),
+	})
+}
+
+// unionOf -nested tagged union from outer to inner tag, fields are added to the innermost union
+func unionOf(fields map[string]any, tags ...string) map[string]any {
+	var union map[string]any
+	for i := len(tags) - 1; i >= 0; i-- {
+		u := map[string]any{".tag": tags[i]}
+		if union != nil {
+			u[tags[i]] = union
+		} else {
+			for k, v := range fields {
+				u[k] = v
+			}
+		}
+		union = u
+	}
+	return union
+}
+
+// writeAuthError -401 with a Dropbox auth error body
+func writeAuthError(w http.ResponseWriter, tag string) {
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error_summary": tag + "/...",
+		"error":         map[string]any{".tag": tag},
+	})
+}
+
+// writeOAuthError -OAuth2 style error body as returned by /oauth2/token
+func writeOAuthError(w http.ResponseWriter, status int, e, description string) {
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":             e,
+		"error_description": description,
+	})
+}
+
+// writeBadRequest -400 with plain text body, like Dropbox does for malformed calls
+func writeBadRequest(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = io.WriteString(w, "Error in call to API function: "+msg)
+}
+
+// authorized -check method and bearer token before calling the handler
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			writeBadRequest(w, "missing bearer token")
+			return
+		}
+		s.mutex.Lock()
+		valid := s.tokens[token]
+		s.mutex.Unlock()
+		if !valid {
+			writeAuthError(w, "invalid_access_token")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// decodeArg -decode JSON request body into v, checking the content type
+func decodeArg(w http.ResponseWriter, r *http.Request, v any) bool {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeJson) {
+		writeBadRequest(w, `Bad HTTP "Content-Type" header`)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeBadRequest(w, "could not decode input as JSON")
+		return false
+	}
+	return true
+}
+
+// validPath -Dropbox paths are either empty (root), absolute or an "id:" reference
+func validPath(w http.ResponseWriter, p string, allowRoot bool) bool {
+	if (p == "" && allowRoot) || strings.HasPrefix(p, api.DbxPathSeparator) || strings.HasPrefix(p, "id:") ||
+		strings.HasPrefix(p, "rev:") {
+		return true
+	}
+	writeBadRequest(w, "path: '"+p+"' did not match pattern")
+	return false
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Basic ")
+	if ok {
+		b, err := base64.StdEncoding.DecodeString(auth)
+		ok = err == nil && string(b) == s.AppKey+":"+s.AppSecret
+	}
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client_id or client_secret")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	result := api.RefreshTokenType{
+		ExpiresIn: tokenLifetime,
+		TokenType: "bearer",
+		AccountId: s.Account.AccountId,
+	}
+	switch r.PostForm.Get("grant_type") {
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != s.RefreshToken {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token is invalid or revoked")
+			return
+		}
+	case "authorization_code":
+		if r.PostForm.Get("code") != s.AuthCode {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code doesn't exist or has expired")
+			return
+		}
+		result.RefreshToken = s.RefreshToken
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	result.AccessToken = newToken()
+	s.mutex.Lock()
+	s.tokens[result.AccessToken] = true
+	s.mutex.Unlock()
+	writeJson(w, result)
+}
+
+func (s *Server) handleGetCurrentAccount(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, s.Account)
+}
+
+func (s *Server) handleListFolder(w http.ResponseWriter, r *http.Request) {
+	var para api.ListFoldersParaType
+	var entries []*entryType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Path, true) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if para.Path == "" {
+		entries = s.children("", para.Recursive)
+	} else {
+		e, ok := s.lookup(para.Path)
+		if !ok {
+			writeRouteError(w, "path", "not_found")
+			return
+		}
+		if !e.isFolder {
+			writeRouteError(w, "path", "not_folder")
+			return
+		}
+		entries = s.children(e.path, para.Recursive)
+	}
+	cursor := &cursorType{limit: int(para.Limit)}
+	for _, e := range entries {
+		cursor.entries = append(cursor.entries, e.metadata())
+	}
+	if para.IncludeDeleted {
+		for _, e := range s.deletedChildren(para.Path, para.Recursive) {
+			cursor.entries = append(cursor.entries, e.deletedMetadata())
+		}
+	}
+	writeJson(w, s.page(cursor))
+}
+
+// searchCategories -file extensions of the search categories, folders and others are matched separately
+var searchCategories = map[string][]string{
+	api.DbxCategoryImage:        {"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "heic", "svg"},
+	api.DbxCategoryDocument:     {"doc", "docx", "odt", "rtf", "txt", "md"},
+	api.DbxCategoryPdf:          {"pdf"},
+	api.DbxCategorySpreadsheet:  {"xls", "xlsx", "ods", "csv"},
+	api.DbxCategoryPresentation: {"ppt", "pptx", "odp", "key"},
+	api.DbxCategoryAudio:        {"mp3", "wav", "flac", "aac", "m4a", "ogg"},
+	api.DbxCategoryVideo:        {"mp4", "mov", "avi", "mkv", "webm"},
+	api.DbxCategoryPaper:        {"paper"},
+}
+
+// searchMatch -check an entry against the query and options, returns the match type
+func searchMatch(e *entryType, query string, options api.SearchOptionsType) (string, bool) {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(e.name), "."))
+	if len(options.FileExtensions) > 0 && (e.isFolder || !slices.ContainsFunc(options.FileExtensions,
+		func(x string) bool { return strings.EqualFold(strings.TrimPrefix(x, "."), ext) })) {
+		return "", false
+	}
+	if len(options.FileCategories) > 0 && !slices.ContainsFunc(options.FileCategories, func(c api.TagType) bool {
+		switch c.Tag {
+		case api.DbxCategoryFolder:
+			return e.isFolder
+		case api.DbxCategoryOthers:
+			for _, exts := range searchCategories {
+				if slices.Contains(exts, ext) {
+					return false
+				}
+			}
+			return !e.isFolder
+		}
+		return !e.isFolder && slices.Contains(searchCategories[c.Tag], ext)
+	}) {
+		return "", false
+	}
+	byName := strings.Contains(strings.ToLower(e.name), query)
+	byContent := !options.FilenameOnly && !e.isFolder && strings.Contains(strings.ToLower(string(e.content)), query)
+	switch {
+	case byName && byContent:
+		return "both", true
+	case byName:
+		return "filename", true
+	case byContent:
+		return "file_content", true
+	}
+	return "", false
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var para api.SearchParaType
+	var entries []*entryType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Options.Path, true) {
+		return
+	}
+	if strings.TrimSpace(para.Query) == "" {
+		writeRouteError(w, "invalid_argument")
+		return
+	}
+	if para.Options.MaxResults > api.DbxMaxSearchResults {
+		writeBadRequest(w, "options.max_results: value is larger than 1000")
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if para.Options.Path == "" {
+		entries = s.children("", true)
+	} else {
+		e, ok := s.lookup(para.Options.Path)
+		if !ok {
+			writeRouteError(w, "path", "not_found")
+			return
+		}
+		entries = s.children(e.path, true)
+	}
+	limit := int(para.Options.MaxResults)
+	if limit == 0 {
+		limit = 100
+	}
+	cursor := &cursorType{limit: limit}
+	query := strings.ToLower(strings.TrimSpace(para.Query))
+	for _, e := range entries {
+		if matchType, ok := searchMatch(e, query, para.Options); ok {
+			cursor.entries = append(cursor.entries, e.metadata())
+			cursor.matchTypes = append(cursor.matchTypes, matchType)
+		}
+	}
+	writeJson(w, s.searchPage(cursor))
+}
+
+func (s *Server) handleSearchContinue(w http.ResponseWriter, r *http.Request) {
+	var para api.ListContinueType
+	if !decodeArg(w, r, &para) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	cursor, ok := s.cursors[para.Cursor]
+	if !ok || cursor.matchTypes == nil {
+		writeRouteError(w, "reset")
+		return
+	}
+	delete(s.cursors, para.Cursor)
+	writeJson(w, s.searchPage(cursor))
+}
+
+// searchPage -cut the next page of matches off the cursor, caller holds the lock
+func (s *Server) searchPage(cursor *cursorType) api.SearchResultType {
+	matchTypes := cursor.matchTypes
+	page := s.page(cursor)
+	cursor.matchTypes = matchTypes[len(page.Entries):]
+	result := api.SearchResultType{Matches: []api.SearchMatchType{}, HasMore: page.HasMore, Cursor: page.Cursor}
+	for i, e := range page.Entries {
+		result.Matches = append(result.Matches, api.SearchMatchType{
+			Metadata:  api.FileItemMetadataType{Tag: "metadata", Metadata: e},
+			MatchType: api.TagType{Tag: matchTypes[i]},
+		})
+	}
+	return result
+}
+
+func (s *Server) handleListFolderContinue(w http.ResponseWriter, r *http.Request) {
+	var para api.ListContinueType
+	if !decodeArg(w, r, &para) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	cursor, ok := s.cursors[para.Cursor]
+	if !ok {
+		writeRouteError(w, "reset")
+		return
+	}
+	delete(s.cursors, para.Cursor)
+	writeJson(w, s.page(cursor))
+}
+
+// page -cut the next page off the cursor, caller holds the lock
+func (s *Server) page(cursor *cursorType) api.ItemInfoType {
+	var result api.ItemInfoType
+	limit := cursor.limit
+	if limit <= 0 || limit > len(cursor.entries) {
+		limit = len(cursor.entries)
+	}
+	result.Entries = cursor.entries[:limit]
+	if result.Entries == nil {
+		result.Entries = []api.FileItemType{}
+	}
+	cursor.entries = cursor.entries[limit:]
+	result.Cursor = s.nextId("cursor:")
+	result.HasMore = len(cursor.entries) > 0
+	if result.HasMore {
+		s.cursors[result.Cursor] = cursor
+	}
+	return result
+}
+
+func (s *Server) handleGetMetadata(w http.ResponseWriter, r *http.Request) {
+	var para api.FilePathParaType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Path, false) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.lookup(para.Path)
+	if !ok {
+		writeRouteError(w, "path", "not_found")
+		return
+	}
+	writeJson(w, e.metadata())
+}
+
+func (s *Server) handleListRevisions(w http.ResponseWriter, r *http.Request) {
+	var para api.ListRevisionsParaType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Path, false) {
+		return
+	}
+	if para.Mode != "" && para.Mode != "path" {
+		writeBadRequest(w, "mode: unknown tag '"+para.Mode+"'")
+		return
+	}
+	if para.Limit > api.DbxMaxRevisions {
+		writeBadRequest(w, "limit: value is larger than 100")
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var result api.RevisionsType
+	e, ok := s.lookup(para.Path)
+	if !ok {
+		// a deleted file lists the revisions it had before it was deleted
+		if e, ok = s.deleted[strings.ToLower(para.Path)]; ok {
+			result.IsDeleted, result.ServerDeleted = true, e.deleted.Format(time.RFC3339)
+		}
+	}
+	if !ok {
+		writeRouteError(w, "path", "not_found")
+		return
+	}
+	if e.isFolder {
+		writeRouteError(w, "path", "not_file")
+		return
+	}
+	limit := int(para.Limit)
+	if limit == 0 {
+		limit = 10
+	}
+	result.Entries = []api.FileItemType{e.metadata()}
+	for i := len(e.history) - 1; i >= 0 && len(result.Entries) < limit; i-- {
+		old := *e
+		old.rev, old.content, old.modified = e.history[i].rev, e.history[i].content, e.history[i].modified
+		result.Entries = append(result.Entries, old.metadata())
+	}
+	writeJson(w, result)
+}
+
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	var para api.RestoreParaType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Path, false) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.lookup(para.Path)
+	if !ok {
+		e, ok = s.deleted[strings.ToLower(para.Path)]
+	}
+	if !ok || e.isFolder {
+		writeRouteError(w, "path_lookup", "not_found")
+		return
+	}
+	old, ok := e.revision(para.Rev)
+	if !ok {
+		writeRouteError(w, "invalid_revision")
+		return
+	}
+	s.mkdirs(path.Dir(e.path))
+	m := s.putFile(e.path, old.content).metadata()
+	m.Tag = "" // restore answers with plain file metadata
+	writeJson(w, m)
+}
+
+func (s *Server) handlePermanentlyDelete(w http.ResponseWriter, r *http.Request) {
+	var para api.FilePathParaType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Path, false) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p := para.Path
+	if e, ok := s.lookup(p); ok {
+		p = e.path
+	}
+	if !s.purge(p) {
+		writeRouteError(w, "path_lookup", "not_found")
+		return
+	}
+	writeJson(w, nil)
+}
+
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request) {
+	s.handleRelocation(w, r, false)
+}
+
+func (s *Server) handleCopy(w http.ResponseWriter, r *http.Request) {
+	s.handleRelocation(w, r, true)
+}
+
+func (s *Server) handleRelocation(w http.ResponseWriter, r *http.Request, duplicate bool) {
+	var para api.FilesMoveParaType
+	if !decodeArg(w, r, &para) || !validPath(w, para.FromPath, false) || !validPath(w, para.ToPath, false) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, tags := s.relocate(para.FromPath, para.ToPath, para.Autorename, duplicate)
+	if e == nil {
+		writeRouteError(w, tags...)
+		return
+	}
+	writeJson(w, api.FileItemMetadataType{Metadata: e.metadata()})
+}
+
+func (s *Server) handleMoveBatch(w http.ResponseWriter, r *http.Request) {
+	s.handleRelocationBatch(w, r, false)
+}
+
+func (s *Server) handleCopyBatch(w http.ResponseWriter, r *http.Request) {
+	s.handleRelocationBatch(w, r, true)
+}
+
+func (s *Server) handleRelocationBatch(w http.ResponseWriter, r *http.Request, duplicate bool) {
+	var para api.RelocationBatchParaType
+	if !decodeArg(w, r, &para) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := &jobType{polls: s.AsyncPolls}
+	for _, entry := range para.Entries {
+		e, tags := s.relocate(entry.FromPath, entry.ToPath, para.Autorename, duplicate)
+		if e == nil {
+			job.entries = append(job.entries, map[string]any{
+				".tag":    "failure",
+				"failure": unionOf(nil, append([]string{"relocation_error"}, tags...)...),
+			})
+			continue
+		}
+		job.entries = append(job.entries, map[string]any{".tag": "success", "success": e.metadata()})
+	}
+	id := s.nextId("dbjid:")
+	s.jobs[id] = job
+	writeJson(w, map[string]any{".tag": api.DbxAsyncJobId, api.DbxAsyncJobId: id})
+}
+
+// relocate -move or copy an entry, returns the entry at its destination or the error tags, caller holds the lock
+func (s *Server) relocate(from, to string, autorename, duplicate bool) (*entryType, []string) {
+	e, ok := s.lookup(from)
+	if !ok {
+		return nil, []string{"from_lookup", "not_found"}
+	}
+	if strings.EqualFold(e.path, to) {
+		return nil, []string{"duplicated_or_nested_paths"}
+	}
+	if e.isFolder && strings.HasPrefix(strings.ToLower(to), strings.ToLower(e.path)+api.DbxPathSeparator) {
+		if duplicate {
+			return nil, []string{"cant_copy_into_itself"}
+		}
+		return nil, []string{"cant_move_folder_into_itself"}
+	}
+	s.mkdirs(path.Dir(to))
+	if existing, ok := s.lookup(to); ok {
+		if !autorename {
+			return nil, []string{"to", "conflict", existing.tag()}
+		}
+		to = s.autorename(to)
+	}
+	if duplicate {
+		return s.copyTree(e, to), nil
+	}
+	s.moveTree(e, to)
+	return e, nil
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	var para api.FilePathParaType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Path, false) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.lookup(para.Path)
+	if !ok {
+		writeRouteError(w, "path_lookup", "not_found")
+		return
+	}
+	s.removeTree(e)
+	writeJson(w, api.FileItemMetadataType{Metadata: e.metadata()})
+}
+
+func (s *Server) handleDeleteBatch(w http.ResponseWriter, r *http.Request) {
+	var para api.DeleteBatchParaType
+	if !decodeArg(w, r, &para) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := &jobType{polls: s.AsyncPolls}
+	for _, p := range para.Entries {
+		e, ok := s.lookup(p.Path)
+		if !ok {
+			job.entries = append(job.entries, map[string]any{
+				".tag":    "failure",
+				"failure": map[string]any{".tag": "path_lookup", "path_lookup": map[string]any{".tag": "not_found"}},
+			})
+			continue
+		}
+		s.removeTree(e)
+		job.entries = append(job.entries, map[string]any{".tag": "success", "metadata": e.metadata()})
+	}
+	id := s.nextId("dbjid:")
+	s.jobs[id] = job
+	writeJson(w, map[string]any{".tag": api.DbxAsyncJobId, api.DbxAsyncJobId: id})
+}
+
+func (s *Server) handleJobCheck(w http.ResponseWriter, r *http.Request) {
+	var para api.BatchCheckParaType
+	if !decodeArg(w, r, &para) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.jobs[para.AsyncJobId]
+	if !ok {
+		writeRouteError(w, "invalid_async_job_id")
+		return
+	}
+	if job.polls > 0 {
+		job.polls--
+		writeJson(w, map[string]any{".tag": api.DbxInProgress})
+		return
+	}
+	delete(s.jobs, para.AsyncJobId)
+	writeJson(w, map[string]any{".tag": api.DbxComplete, "entries": job.entries})
+}
+
+func (s *Server) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	var para api.CreateFolderParaType
+	if !decodeArg(w, r, &para) || !validPath(w, para.Path, false) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p := para.Path
+	if existing, ok := s.lookup(p); ok {
+		if !para.Autorename {
+			writeRouteError(w, "path", "conflict", existing.tag())
+			return
+		}
+		p = s.autorename(p)
+	}
+	s.mkdirs(p)
+	e, _ := s.lookup(p)
+	m := e.metadata()
+	m.Tag = "" // create_folder_v2 returns the metadata without tag
+	writeJson(w, map[string]any{"metadata": m})
+}
+
+func (s *Server) handleCreateFolderBatch(w http.ResponseWriter, r *http.Request) {
+	var para api.CreateFolderBatchParaType
+	if !decodeArg(w, r, &para) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := &jobType{polls: s.AsyncPolls}
+	for _, p := range para.Paths {
+		existing, ok := s.lookup(p)
+		if ok && !para.Autorename {
+			job.entries = append(job.entries, map[string]any{
+				".tag":    "failure",
+				"failure": unionOf(nil, "path", "conflict", existing.tag()),
+			})
+			continue
+		}
+		if ok {
+			p = s.autorename(p)
+		}
+		s.mkdirs(p)
+		e, _ := s.lookup(p)
+		m := e.metadata()
+		m.Tag = "" // like create_folder_v2 without tag
+		job.entries = append(job.entries, map[string]any{".tag": "success", "metadata": m})
+	}
+	id := s.nextId("dbjid:")
+	s.jobs[id] = job
+	writeJson(w, map[string]any{".tag": api.DbxAsyncJobId, api.DbxAsyncJobId: id})
+}
+
+// commitType -commit info of uploads and upload sessions
+type commitType struct {
+	Path       string        `json:"path"`
+	AutoRename bool          `json:"autorename"`
+	Mode       writeModeType `json:"mode"`
+}
+
+// writeModeType -write mode, either a plain string or a tagged union carrying the rev to update
+type writeModeType struct {
+	Tag    string `json:".tag"`
+	Update string `json:"update"`
+}
+
+func (m *writeModeType) UnmarshalJSON(b []byte) error {
+	if json.Unmarshal(b, &m.Tag) == nil {
+		return nil
+	}
+	type union writeModeType
+	return json.Unmarshal(b, (*union)(m))
+}
+
+// decodeHeaderArg -decode the Dropbox-API-Arg header of content endpoints, checking the content type
+func decodeHeaderArg(w http.ResponseWriter, r *http.Request, v any) bool {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeOctetStream) {
+		writeBadRequest(w, `Bad HTTP "Content-Type" header`)
+		return false
+	}
+	arg := r.Header.Get("Dropbox-API-Arg")
+	for _, c := range arg {
+		if c >= 0x7f {
+			writeBadRequest(w, "Dropbox-API-Arg must be ASCII, escape other characters")
+			return false
+		}
+	}
+	if json.Unmarshal([]byte(arg), v) != nil {
+		writeBadRequest(w, "could not decode Dropbox-API-Arg")
+		return false
+	}
+	return true
+}
+
+// commit -write uploaded content according to the commit info, caller holds the lock
+func (s *Server) commit(w http.ResponseWriter, commit commitType, content []byte) {
+	p := commit.Path
+	if existing, ok := s.lookup(p); ok {
+		conflict := existing.isFolder
+		switch commit.Mode.Tag {
+		case "", string(api.Add):
+			conflict = true
+		case string(api.Update):
+			conflict = conflict || existing.rev != commit.Mode.Update
+		}
+		if conflict {
+			if !commit.AutoRename {
+				writeRouteError(w, "path", "conflict", existing.tag())
+				return
+			}
+			p = s.autorename(p)
+		} else if string(existing.content) == string(content) {
+			writeJson(w, existing.metadata()) // identical content, no new revision
+			return
+		}
+	}
+	s.mkdirs(path.Dir(p))
+	writeJson(w, s.putFile(p, content).metadata())
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	var para struct {
+		commitType
+		ContentHash string `json:"content_hash"`
+	}
+	if !decodeHeaderArg(w, r, &para) || !validPath(w, para.Path, false) {
+		return
+	}
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if para.ContentHash != "" && para.ContentHash != api.ConputeHash(content) {
+		writeRouteError(w, "content_hash_mismatch")
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commit(w, para.commitType, content)
+}
+
+func (s *Server) handleUploadSessionStart(w http.ResponseWriter, r *http.Request) {
+	var para api.UploadSessionStartParaType
+	if !decodeHeaderArg(w, r, &para) {
+		return
+	}
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := s.nextId("session:")
+	s.sessions[id] = &sessionType{content: content, closed: para.Close}
+	writeJson(w, api.UploadSessionStartType{SessionId: id})
+}
+
+// appendSession -check the cursor and append content, writes the error answer and returns nil on failure,
+// tags are the outer tags of the error union, caller holds the lock
+func (s *Server) appendSession(w http.ResponseWriter, cursor api.UploadSessionCursorType, content []byte,
+	tags ...string) *sessionType {
+	session, ok := s.sessions[cursor.SessionId]
+	switch {
+	case !ok:
+		writeRouteError(w, append(tags, "not_found")...)
+		return nil
+	case cursor.Offset != int64(len(session.content)):
+		writeUnionError(w, map[string]any{"correct_offset": len(session.content)}, append(tags, "incorrect_offset")...)
+		return nil
+	case session.closed && len(content) > 0:
+		writeRouteError(w, append(tags, "closed")...)
+		return nil
+	}
+	session.content = append(session.content, content...)
+	return session
+}
+
+func (s *Server) handleUploadSessionAppend(w http.ResponseWriter, r *http.Request) {
+	var para api.UploadSessionAppendParaType
+	if !decodeHeaderArg(w, r, &para) {
+		return
+	}
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if session := s.appendSession(w, para.Cursor, content); session != nil {
+		session.closed = para.Close
+		writeJson(w, nil)
+	}
+}
+
+func (s *Server) handleUploadSessionFinish(w http.ResponseWriter, r *http.Request) {
+	var para struct {
+		Cursor      api.UploadSessionCursorType `json:"cursor"`
+		Commit      commitType                  `json:"commit"`
+		ContentHash string                      `json:"content_hash"`
+	}
+	if !decodeHeaderArg(w, r, &para) || !validPath(w, para.Commit.Path, false) {
+		return
+	}
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	session := s.appendSession(w, para.Cursor, content, "lookup_failed")
+	if session == nil {
+		return
+	}
+	if para.ContentHash != "" && para.ContentHash != api.ConputeHash(session.content) {
+		writeRouteError(w, "content_hash_mismatch")
+		return
+	}
+	delete(s.sessions, para.Cursor.SessionId)
+	s.commit(w, para.Commit, session.content)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	var para api.FilePathParaType
+	if r.Header.Get("Content-Type") != "" {
+		writeBadRequest(w, `Bad HTTP "Content-Type" header, expected none`)
+		return
+	}
+	if json.Unmarshal([]byte(r.Header.Get("Dropbox-API-Arg")), &para) != nil {
+		writeBadRequest(w, "could not decode Dropbox-API-Arg")
+		return
+	}
+	if !validPath(w, para.Path, false) {
+		return
+	}
+	s.mutex.Lock()
+	e, ok := s.lookup(para.Path)
+	if !ok {
+		s.mutex.Unlock()
+		writeRouteError(w, "path", "not_found")
+		return
+	}
+	if e.isFolder {
+		s.mutex.Unlock()
+		writeRouteError(w, "path", "not_file")
+		return
+	}
+	metadata := e.metadata()
+	content := e.content
+	s.mutex.Unlock()
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, ok := rangeStart(rng)
+		if !ok || start >= len(content) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+		content, status = content[start:], http.StatusPartialContent
+	}
+	result, _ := json.Marshal(metadata)
+	w.Header().Set("Dropbox-API-Result", asciiJson(result))
+	w.Header().Set("Content-Type", contentTypeOctetStream)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(status)
+	_, _ = w.Write(content)
+}
+
+// rangeStart -first byte of an open ended Range header "bytes=n-", the only form the client sends
+func rangeStart(rng string) (int, bool) {
+	from, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok || !strings.HasSuffix(from, "-") {
+		return 0, false
+	}
+	start, err := strconv.Atoi(strings.TrimSuffix(from, "-"))
+	return start, err == nil && start >= 0
+}
+
+// asciiJson -escape non-ASCII characters, as Dropbox does for JSON in http headers
+func (s *Server) handleDownloadZip(w http.ResponseWriter, r *http.Request) {
+	var para api.FilePathParaType
+	var buf bytes.Buffer
+	if r.Header.Get("Content-Type") != "" {
+		writeBadRequest(w, `Bad HTTP "Content-Type" header, expected none`)
+		return
+	}
+	if json.Unmarshal([]byte(r.Header.Get("Dropbox-API-Arg")), &para) != nil {
+		writeBadRequest(w, "could not decode Dropbox-API-Arg")
+		return
+	}
+	if !validPath(w, para.Path, false) {
+		return
+	}
+	s.mutex.Lock()
+	e, ok := s.lookup(para.Path)
+	if !ok {
+		s.mutex.Unlock()
+		writeRouteError(w, "path", "not_found")
+		return
+	}
+	if !e.isFolder {
+		s.mutex.Unlock()
+		writeRouteError(w, "path", "not_folder")
+		return
+	}
+	// like Dropbox, the archive contains the folder itself as top level entry
+	archive := zip.NewWriter(&buf)
+	_, _ = archive.Create(e.name + api.DbxPathSeparator)
+	for _, child := range s.children(e.path, true) {
+		name := e.name + child.path[len(e.path):]
+		if child.isFolder {
+			_, _ = archive.Create(name + api.DbxPathSeparator)
+			continue
+		}
+		f, _ := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: child.modified})
+		_, _ = f.Write(child.content)
+	}
+	_ = archive.Close()
+	metadata := e.metadata()
+	s.mutex.Unlock()
+	result, _ := json.Marshal(api.DownloadZipResultType{Metadata: metadata})
+	w.Header().Set("Dropbox-API-Result", asciiJson(result))
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func asciiJson(j []byte) string {
+	var sb strings.Builder
+	for _, c := range string(j) {
+		if c < 0x7f {
+			sb.WriteRune(c)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{c}) {
+			_, _ = fmt.Fprintf(&sb, "\\u%04x", u)
+		}
+	}
+	return sb.String()
+}
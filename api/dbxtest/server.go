@@ -0,0 +1,532 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// In-memory Dropbox stand-in server for tests
+// ---------------------------------------------------------------------------------------------------------------------
+
+package dbxtest
+
+import (
+	"Dropbox_REST_Client/api"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default credentials accepted by a new server
+const (
+	AppKey       = "test-app-key"
+	AppSecret    = "test-app-secret"
+	RefreshToken = "test-refresh-token"
+	AuthCode     = "test-auth-code"
+)
+
+const tokenLifetime = 14400 // seconds, same as Dropbox short-lived tokens
+
+type entryType struct {
+	id       string
+	name     string
+	path     string // display path, "/a/B.txt"
+	isFolder bool
+	rev      string
+	content  []byte
+	modified time.Time
+	history  []revisionType // older revisions of a file, oldest first
+	deleted  time.Time      // when a removed entry was deleted
+}
+
+type revisionType struct {
+	rev      string
+	content  []byte
+	modified time.Time
+}
+
+type jobType struct {
+	polls   int // remaining in_progress answers
+	entries []any
+}
+
+type sessionType struct {
+	content []byte
+	closed  bool
+}
+
+type failureType struct {
+	status int
+	count  int
+}
+
+type cursorType struct {
+	entries    []api.FileItemType
+	matchTypes []string // match type of every entry of a search cursor
+	limit      int
+}
+
+// Server -httptest.Server emulating the Dropbox endpoints used by the api package, backed by an in-memory file tree
+type Server struct {
+	*httptest.Server
+	AppKey       string
+	AppSecret    string
+	RefreshToken string
+	AuthCode     string
+	// AsyncPolls -number of in_progress answers an async job returns before it reports complete
+	AsyncPolls int
+	// RetryAfter -seconds sent in the Retry-After header of injected 429 answers
+	RetryAfter int
+	// Account -returned by get_current_account
+	Account  api.UserInfoType
+	mutex    sync.Mutex
+	entries  map[string]*entryType // key: lower case path
+	deleted  map[string]*entryType // removed entries, key: lower case path
+	tokens   map[string]bool
+	jobs     map[string]*jobType
+	cursors  map[string]*cursorType
+	sessions map[string]*sessionType
+	failures map[string]*failureType
+	calls    map[string]int
+	counter  int
+}
+
+// NewServer -start a new stand-in server with an empty Dropbox, close it with Close()
+func NewServer() *Server {
+	s := &Server{
+		AppKey:       AppKey,
+		AppSecret:    AppSecret,
+		RefreshToken: RefreshToken,
+		AuthCode:     AuthCode,
+		Account: api.UserInfoType{
+			AccountId:   "dbid:test-account",
+			AccountType: api.AccountTypeType{Tag: "basic"},
+			Country:     "DE",
+			Email:       "test@example.com",
+			Name:        api.NameType{DisplayName: "Test User"},
+			RootInfo:    api.RootInfoType{Tag: "user", HomeNamespaceId: "1", RootNamespaceId: "1"},
+		},
+		entries:  map[string]*entryType{},
+		deleted:  map[string]*entryType{},
+		tokens:   map[string]bool{},
+		jobs:     map[string]*jobType{},
+		cursors:  map[string]*cursorType{},
+		sessions: map[string]*sessionType{},
+		failures: map[string]*failureType{},
+		calls:    map[string]int{},
+	}
+	s.Server = httptest.NewServer(s.faulty(s.routes()))
+	return s
+}
+
+// Endpoints -auth, API and content URIs pointing to this server
+func (s *Server) Endpoints() api.EndpointsType {
+	return api.EndpointsType{
+		AuthURI:    s.URL + "/oauth2/authorize",
+		APIURI:     s.URL,
+		ContentURI: s.URL,
+	}
+}
+
+// NewClient -api client authorized against this server
+func (s *Server) NewClient() *api.Client {
+	c := api.NewClient(api.AppAuthType{AppKey: s.AppKey, AppSecret: s.AppSecret}, s.RefreshToken)
+	c.SetEndpoints(s.Endpoints())
+	c.SetHTTPClient(s.Client())
+	return c
+}
+
+// ExpireTokens -invalidate all access tokens handed out so far
+func (s *Server) ExpireTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens = map[string]bool{}
+}
+
+// InjectFailure -answer the next count calls to endpoint (e.g. "/2/files/list_folder") with the http status,
+// 429 answers carry a Dropbox rate limit body and a Retry-After header
+func (s *Server) InjectFailure(endpoint string, status int, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[endpoint] = &failureType{status: status, count: count}
+}
+
+// Calls -number of requests received for endpoint, including failed ones
+func (s *Server) Calls(endpoint string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls[endpoint]
+}
+
+// AddFolder -create a folder (and missing parents)
+func (s *Server) AddFolder(p string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mkdirs(p)
+}
+
+// AddFile -create or replace a file (and missing parents)
+func (s *Server) AddFile(p string, content []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mkdirs(path.Dir(p))
+	s.putFile(p, content)
+}
+
+// Exists -check whether a file or folder exists
+func (s *Server) Exists(p string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.entries[strings.ToLower(p)]
+	return ok
+}
+
+// Content -content of a file
+func (s *Server) Content(p string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.entries[strings.ToLower(p)]
+	if !ok || e.isFolder {
+		return nil, false
+	}
+	return append([]byte(nil), e.content...), true
+}
+
+// Metadata -Dropbox metadata of a file or folder
+func (s *Server) Metadata(p string) (api.FileItemType, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.entries[strings.ToLower(p)]
+	if !ok {
+		return api.FileItemType{}, false
+	}
+	return e.metadata(), true
+}
+
+// Paths -display paths of all entries, sorted
+func (s *Server) Paths() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var paths []string
+	for _, e := range s.entries {
+		paths = append(paths, e.path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+func (s *Server) nextId(prefix string) string {
+	s.counter++
+	return fmt.Sprintf("%s%06d", prefix, s.counter)
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// mkdirs -create folder and missing parents, caller holds the lock
+func (s *Server) mkdirs(p string) {
+	if p == "" || p == api.DbxPathSeparator || p == "." {
+		return
+	}
+	s.mkdirs(path.Dir(p))
+	if _, ok := s.entries[strings.ToLower(p)]; ok {
+		return
+	}
+	delete(s.deleted, strings.ToLower(p))
+	s.entries[strings.ToLower(p)] = &entryType{
+		id:       s.nextId("id:"),
+		name:     path.Base(p),
+		path:     p,
+		isFolder: true,
+	}
+}
+
+// putFile -create or replace file, parent must exist, caller holds the lock
+func (s *Server) putFile(p string, content []byte) *entryType {
+	e, ok := s.entries[strings.ToLower(p)]
+	if !ok {
+		e = &entryType{id: s.nextId("id:"), name: path.Base(p), path: p}
+		if old, ok := s.deleted[strings.ToLower(p)]; ok && !old.isFolder {
+			// the history of a deleted file continues when the path is used again
+			e.history = append(old.history, revisionType{rev: old.rev, content: old.content, modified: old.modified})
+			delete(s.deleted, strings.ToLower(p))
+		}
+		s.entries[strings.ToLower(p)] = e
+	} else if !e.isFolder {
+		e.history = append(e.history, revisionType{rev: e.rev, content: e.content, modified: e.modified})
+	}
+	e.content = append([]byte(nil), content...)
+	s.counter++
+	e.rev = fmt.Sprintf("%015x", s.counter)
+	e.modified = time.Now().UTC().Truncate(time.Second)
+	return e
+}
+
+// lookup -resolve path, "id:" or "rev:" reference, a revision resolves to a detached entry, caller holds the lock
+func (s *Server) lookup(p string) (*entryType, bool) {
+	if rev, ok := strings.CutPrefix(p, "rev:"); ok {
+		for _, entries := range []map[string]*entryType{s.entries, s.deleted} {
+			for _, e := range entries {
+				if r, ok := e.revision(rev); ok {
+					detached := *e
+					detached.rev, detached.content, detached.modified, detached.history = r.rev, r.content, r.modified,
+						nil
+					return &detached, true
+				}
+			}
+		}
+		return nil, false
+	}
+	if strings.HasPrefix(p, "id:") {
+		for _, e := range s.entries {
+			if e.id == p {
+				return e, true
+			}
+		}
+		return nil, false
+	}
+	e, ok := s.entries[strings.ToLower(p)]
+	return e, ok
+}
+
+// children -entries below folder p (all descendants if recursive), sorted by path, caller holds the lock
+func (s *Server) children(p string, recursive bool) []*entryType {
+	var result []*entryType
+	prefix := strings.ToLower(strings.TrimSuffix(p, api.DbxPathSeparator)) + api.DbxPathSeparator
+	for key, e := range s.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if !recursive && strings.Contains(strings.TrimPrefix(key, prefix), api.DbxPathSeparator) {
+			continue
+		}
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return strings.ToLower(result[i].path) < strings.ToLower(result[j].path) })
+	return result
+}
+
+// removeTree -delete entry and all descendants, they are kept as deleted entries, caller holds the lock
+func (s *Server) removeTree(e *entryType) {
+	now := time.Now().UTC().Truncate(time.Second)
+	if e.isFolder {
+		for _, c := range s.children(e.path, true) {
+			delete(s.entries, strings.ToLower(c.path))
+			c.deleted = now
+			s.deleted[strings.ToLower(c.path)] = c
+		}
+	}
+	delete(s.entries, strings.ToLower(e.path))
+	e.deleted = now
+	s.deleted[strings.ToLower(e.path)] = e
+}
+
+// deletedChildren -deleted entries below folder p (all descendants if recursive) that have not been
+// replaced, sorted by path, caller holds the lock
+func (s *Server) deletedChildren(p string, recursive bool) []*entryType {
+	var result []*entryType
+	prefix := strings.ToLower(strings.TrimSuffix(p, api.DbxPathSeparator)) + api.DbxPathSeparator
+	for key, e := range s.deleted {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if !recursive && strings.Contains(strings.TrimPrefix(key, prefix), api.DbxPathSeparator) {
+			continue
+		}
+		if _, ok := s.entries[key]; !ok {
+			result = append(result, e)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return strings.ToLower(result[i].path) < strings.ToLower(result[j].path) })
+	return result
+}
+
+// purge -remove entry and all descendants for good, live or deleted, caller holds the lock
+func (s *Server) purge(p string) bool {
+	key := strings.ToLower(p)
+	_, live := s.entries[key]
+	_, deleted := s.deleted[key]
+	for _, m := range []map[string]*entryType{s.entries, s.deleted} {
+		for k := range m {
+			if k == key || strings.HasPrefix(k, key+api.DbxPathSeparator) {
+				delete(m, k)
+			}
+		}
+	}
+	return live || deleted
+}
+
+// moveTree -re-key entry and all descendants, caller holds the lock
+func (s *Server) moveTree(e *entryType, to string) {
+	from := e.path
+	if e.isFolder {
+		for _, c := range s.children(from, true) {
+			delete(s.entries, strings.ToLower(c.path))
+			c.path = to + strings.TrimPrefix(c.path, from)
+			s.entries[strings.ToLower(c.path)] = c
+		}
+	}
+	delete(s.entries, strings.ToLower(from))
+	e.path = to
+	e.name = path.Base(to)
+	s.entries[strings.ToLower(to)] = e
+}
+
+// copyTree -duplicate entry and all descendants at to with new ids, returns the copy, caller holds the lock
+func (s *Server) copyTree(e *entryType, to string) *entryType {
+	from := e.path
+	var copies []*entryType
+	if e.isFolder {
+		copies = s.children(from, true)
+	}
+	for _, c := range append(copies, e) {
+		dup := *c
+		dup.id = s.nextId("id:")
+		dup.path = to + strings.TrimPrefix(c.path, from)
+		dup.name = path.Base(dup.path)
+		dup.content = append([]byte(nil), c.content...)
+		s.entries[strings.ToLower(dup.path)] = &dup
+	}
+	return s.entries[strings.ToLower(to)]
+}
+
+// autorename -first free "name (n).ext" variant of p, caller holds the lock
+func (s *Server) autorename(p string) string {
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, ok := s.entries[strings.ToLower(candidate)]; !ok {
+			return candidate
+		}
+	}
+}
+
+// revision -current or older revision of a file
+func (e *entryType) revision(rev string) (revisionType, bool) {
+	if e.isFolder {
+		return revisionType{}, false
+	}
+	if e.rev == rev {
+		return revisionType{rev: e.rev, content: e.content, modified: e.modified}, true
+	}
+	for _, r := range e.history {
+		if r.rev == rev {
+			return r, true
+		}
+	}
+	return revisionType{}, false
+}
+
+func (e *entryType) tag() string {
+	if e.isFolder {
+		return api.DbxFolder
+	}
+	return api.DbxFile
+}
+
+// deletedMetadata -metadata of a deleted entry as listed with include_deleted
+func (e *entryType) deletedMetadata() api.FileItemType {
+	return api.FileItemType{
+		Tag:         api.DbxDeleted,
+		Name:        e.name,
+		PathDisplay: e.path,
+		PathLower:   strings.ToLower(e.path),
+	}
+}
+
+func (e *entryType) metadata() api.FileItemType {
+	m := api.FileItemType{
+		Tag:         e.tag(),
+		Id:          e.id,
+		Name:        e.name,
+		PathDisplay: e.path,
+		PathLower:   strings.ToLower(e.path),
+	}
+	if !e.isFolder {
+		m.ClientModified = e.modified.Format(time.RFC3339)
+		m.ServerModified = m.ClientModified
+		m.Rev = e.rev
+		m.Size = int64(len(e.content))
+		m.ContentHash = api.ConputeHash(e.content)
+		m.IsDownloadable = true
+	}
+	return m
+}
+
+// faulty -count calls and answer with injected failures before passing requests on
+func (s *Server) faulty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		s.calls[r.URL.Path]++
+		f, ok := s.failures[r.URL.Path]
+		if ok && f.count > 0 {
+			f.count--
+		} else {
+			ok = false
+		}
+		s.mutex.Unlock()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if f.status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+			w.Header().Set("Content-Type", contentTypeJson)
+			w.WriteHeader(f.status)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error_summary": "too_many_requests/...",
+				"error": map[string]any{
+					"reason":      map[string]any{".tag": "too_many_requests"},
+					"retry_after": s.RetryAfter,
+				},
+			})
+			return
+		}
+		w.WriteHeader(f.status)
+		_, _ = io.WriteString(w, http.StatusText(f.status))
+	})
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", s.handleToken)
+	mux.HandleFunc("/2/users/get_current_account", s.authorized(s.handleGetCurrentAccount))
+	mux.HandleFunc("/2/files/list_folder", s.authorized(s.handleListFolder))
+	mux.HandleFunc("/2/files/list_folder/continue", s.authorized(s.handleListFolderContinue))
+	mux.HandleFunc("/2/files/get_metadata", s.authorized(s.handleGetMetadata))
+	mux.HandleFunc("/2/files/list_revisions", s.authorized(s.handleListRevisions))
+	mux.HandleFunc("/2/files/restore", s.authorized(s.handleRestore))
+	mux.HandleFunc("/2/files/permanently_delete", s.authorized(s.handlePermanentlyDelete))
+	mux.HandleFunc("/2/files/search_v2", s.authorized(s.handleSearch))
+	mux.HandleFunc("/2/files/search/continue_v2", s.authorized(s.handleSearchContinue))
+	mux.HandleFunc("/2/files/move_v2", s.authorized(s.handleMove))
+	mux.HandleFunc("/2/files/move_batch_v2", s.authorized(s.handleMoveBatch))
+	mux.HandleFunc("/2/files/move_batch/check_v2", s.authorized(s.handleJobCheck))
+	mux.HandleFunc("/2/files/copy_v2", s.authorized(s.handleCopy))
+	mux.HandleFunc("/2/files/copy_batch_v2", s.authorized(s.handleCopyBatch))
+	mux.HandleFunc("/2/files/copy_batch/check_v2", s.authorized(s.handleJobCheck))
+	mux.HandleFunc("/2/files/delete_v2", s.authorized(s.handleDelete))
+	mux.HandleFunc("/2/files/delete_batch", s.authorized(s.handleDeleteBatch))
+	mux.HandleFunc("/2/files/delete_batch/check", s.authorized(s.handleJobCheck))
+	mux.HandleFunc("/2/files/create_folder_v2", s.authorized(s.handleCreateFolder))
+	mux.HandleFunc("/2/files/create_folder_batch", s.authorized(s.handleCreateFolderBatch))
+	mux.HandleFunc("/2/files/create_folder_batch/check", s.authorized(s.handleJobCheck))
+	mux.HandleFunc("/2/files/upload", s.authorized(s.handleUpload))
+	mux.HandleFunc("/2/files/download", s.authorized(s.handleDownload))
+	mux.HandleFunc("/2/files/download_zip", s.authorized(s.handleDownloadZip))
+	mux.HandleFunc("/2/files/upload_session/start", s.authorized(s.handleUploadSessionStart))
+	mux.HandleFunc("/2/files/upload_session/append_v2", s.authorized(s.handleUploadSessionAppend))
+	mux.HandleFunc("/2/files/upload_session/finish", s.authorized(s.handleUploadSessionFinish))
+	return mux
+}
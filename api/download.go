@@ -0,0 +1,310 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - streaming downloads
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"Dropbox_REST_Client/assets"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	partialFileSuffix  = ".part"
+	partialStateSuffix = ".state" // sidecar of a partial download
+)
+
+// downloadStateType -revision a partial download belongs to
+type downloadStateType struct {
+	Path string `json:"path"`
+	Rev  string `json:"rev"`
+}
+
+// DownloadReader -open a download stream for a file, the caller must close the returned reader,
+// the metadata is taken from the Dropbox-API-Result header
+func (c *Client) DownloadReader(ctx context.Context, path string) (io.ReadCloser, *FileItemType, error) {
+	var metadata FileItemType
+	resp, err := downloadCall(ctx, c, endPointFilesDownload, FilePathParaType{path}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = json.Unmarshal([]byte(resp.Header.Get(paraDbxAPIResult)), &metadata)
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, nil, err
+	}
+	return resp.Body, &metadata, nil
+}
+
+// Download -write the content of a file to w, the content hash is verified against the metadata
+func (c *Client) Download(ctx context.Context, path string, w io.Writer, progress ProgressFunc) (*FileItemType,
+	error) {
+	body, metadata, err := c.DownloadReader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(body)
+	hasher := NewContentHasher()
+	var reader io.Reader = body
+	if progress != nil {
+		reader = &progressReader{reader: body, progress: func(read int64) {
+			progress(read, metadata.Size)
+		}}
+	}
+	n, err := io.Copy(io.MultiWriter(w, hasher), reader)
+	if err != nil {
+		return nil, err
+	}
+	if n != metadata.Size || hasher.HexSum() != metadata.ContentHash {
+		return nil, errors.New(assets.ErrorContentHashMismatch)
+	}
+	return metadata, nil
+}
+
+// downloadCall -generic call to a content download endpoint, argument in the Dropbox-API-Arg header,
+// returns the unread response, the caller must close its body
+func downloadCall(ctx context.Context, c *Client, endpoint string, arg any, header []KeyValueType) (*http.Response,
+	error) {
+	token, err := c.requestAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jarg, err := headerJson(arg)
+	if err != nil {
+		return nil, err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.contentURL(endpoint),
+		ParaMethod: http.MethodPost,
+		ParaHeader: append([]KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraDbxAPIArg, jarg},
+		}, header...),
+		ParaForm:       url.Values{},
+		ParaBody:       nil,
+		ParaIdempotent: true,
+		ParaDownload:   true,
+	}
+	return restStream(ctx, c, para)
+}
+
+// DownloadToFile -download a file to osPath, the content is written to a partial file in the same folder,
+// which replaces osPath only after the content hash has been verified, an interrupted download is continued
+// with a Range request as long as the revision of the file is unchanged
+func (c *Client) DownloadToFile(ctx context.Context, path string, osPath string, progress ProgressFunc) (*FileItemType,
+	error) {
+	partial := partialDownloadName(osPath)
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := c.downloadPartial(ctx, path, f, partial+partialStateSuffix, progress)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, err
+	}
+	if modified, e := time.Parse(time.RFC3339, metadata.ClientModified); e == nil {
+		_ = os.Chtimes(partial, modified, modified)
+	}
+	if err = os.Rename(partial, osPath); err != nil {
+		return nil, err
+	}
+	_ = os.Remove(partial + partialStateSuffix)
+	return metadata, nil
+}
+
+// DiscardPartialDownload -remove what an interrupted DownloadToFile has left for osPath
+func DiscardPartialDownload(osPath string) {
+	partial := partialDownloadName(osPath)
+	_ = os.Remove(partial)
+	_ = os.Remove(partial + partialStateSuffix)
+}
+
+func partialDownloadName(osPath string) string {
+	dir, name := filepath.Split(osPath)
+	return filepath.Join(dir, "."+name+partialFileSuffix)
+}
+
+// downloadPartial -download a file into f, continuing the content already in f if the sidecar stateFile
+// records the same revision, the content of another revision is discarded
+func (c *Client) downloadPartial(ctx context.Context, path string, f *os.File, stateFile string,
+	progress ProgressFunc) (*FileItemType, error) {
+	var state downloadStateType
+	var metadata FileItemType
+	var resp *http.Response
+	var offset int64
+	ctx = withTransferLimiter(ctx) // the per transfer limit spans all Range requests
+	if j, err := os.ReadFile(stateFile); err == nil && json.Unmarshal(j, &state) == nil && state.Path == path {
+		if stat, err := f.Stat(); err == nil {
+			offset = stat.Size()
+		}
+	}
+	for {
+		var header []KeyValueType
+		if offset > 0 {
+			header = []KeyValueType{{paraRange, fmt.Sprintf("bytes=%d-", offset)}}
+		}
+		var err error
+		resp, err = downloadCall(ctx, c, endPointFilesDownload, FilePathParaType{path}, header)
+		var dbxErr *DropboxError
+		if offset > 0 && errors.As(err, &dbxErr) && dbxErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			offset = 0
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(resp.Header.Get(paraDbxAPIResult)), &metadata); err != nil {
+			_ = resp.Body.Close()
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			offset = 0 // complete content
+			break
+		}
+		if offset > 0 && metadata.Rev == state.Rev {
+			break
+		}
+		// the file has been changed since the partial download, start from scratch
+		_ = resp.Body.Close()
+		offset = 0
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+	state = downloadStateType{Path: path, Rev: metadata.Rev}
+	j, err := json.Marshal(state)
+	if err == nil {
+		err = os.WriteFile(stateFile, j, 0644)
+	}
+	if err == nil {
+		err = f.Truncate(offset)
+	}
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the content hash covers the whole file, the part already downloaded is hashed again
+	hasher := NewContentHasher()
+	if _, err = io.Copy(hasher, io.NewSectionReader(f, 0, offset)); err != nil {
+		return nil, err
+	}
+	var reader io.Reader = resp.Body
+	if progress != nil {
+		reader = &progressReader{reader: resp.Body, progress: func(read int64) {
+			progress(offset+read, metadata.Size)
+		}}
+	}
+	n, err := io.Copy(io.MultiWriter(f, hasher), reader)
+	if err != nil {
+		return nil, err // the partial file is continued by the next attempt
+	}
+	if offset+n != metadata.Size || hasher.HexSum() != metadata.ContentHash {
+		_ = f.Truncate(0)
+		_ = os.Remove(stateFile)
+		return nil, errors.New(assets.ErrorContentHashMismatch)
+	}
+	return &metadata, nil
+}
+
+// DownloadZip -write the content of a folder as zip archive to w, progress reports the bytes written, total is -1
+func (c *Client) DownloadZip(ctx context.Context, path string, w io.Writer, progress ProgressFunc) (*FileItemType,
+	error) {
+	var result DownloadZipResultType
+	resp, err := downloadCall(ctx, c, endPointFilesDownloadZip, FilePathParaType{path}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if err = json.Unmarshal([]byte(resp.Header.Get(paraDbxAPIResult)), &result); err != nil {
+		return nil, err
+	}
+	var reader io.Reader = resp.Body
+	if progress != nil {
+		reader = &progressReader{reader: resp.Body, progress: func(read int64) {
+			progress(read, -1)
+		}}
+	}
+	if _, err = io.Copy(w, reader); err != nil {
+		return nil, err
+	}
+	result.Metadata.Tag = DbxFolder
+	return &result.Metadata, nil
+}
+
+// DownloadZipToFile -download a folder as zip archive to osPath, written via temporary file like DownloadToFile,
+// the existing files strategy decides about an existing osPath, metadata is nil if it is kept
+func (c *Client) DownloadZipToFile(ctx context.Context, path string, osPath string, progress ProgressFunc) (
+	*FileItemType, error) {
+	osPath, skip, err := existingTarget(osPath, c.ExistingFilesStrategy())
+	if err != nil || skip {
+		return nil, err
+	}
+	dir, name := filepath.Split(osPath)
+	tmp, err := os.CreateTemp(dir, "."+name+".*"+partialFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer func(name string) {
+		_ = os.Remove(name) // no-op after successful rename
+	}(tmp.Name())
+	metadata, err := c.DownloadZip(ctx, path, tmp, progress)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp.Name(), osPath); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// DownloadFolder -download a folder as zip archive and extract it into dir, the folder itself is created in dir,
+// files already there are kept if unchanged, otherwise the existing files strategy decides about them
+func (c *Client) DownloadFolder(ctx context.Context, path string, dir string, progress ProgressFunc) (*FileItemType,
+	error) {
+	tmp, err := os.CreateTemp(dir, ".download-*.zip"+partialFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(tmp.Name())
+	metadata, err := c.DownloadZip(ctx, path, tmp, progress)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = c.ExtractZip(ctx, tmp.Name(), dir); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
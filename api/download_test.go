@@ -0,0 +1,361 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - downloads, their resumption and existing local files
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/assets"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+const endpointDownload = "/2/files/download"
+
+func TestDownloadToFile(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"small", 10},
+		{"several buffers", 3*1024*1024 + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			content := testContent(tt.size)
+			s.AddFile("/file.bin", content)
+			osPath := filepath.Join(t.TempDir(), "file.bin")
+			var reported, total int64
+			metadata, err := c.DownloadToFile(context.Background(), "/file.bin", osPath, func(transferred, size int64) {
+				reported, total = transferred, size
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(osPath); !bytes.Equal(got, content) {
+				t.Errorf("downloaded %d bytes, want %d", len(got), len(content))
+			}
+			if tt.size > 0 && (reported != int64(tt.size) || total != int64(tt.size)) {
+				t.Errorf("progress = %d of %d, want %d", reported, total, tt.size)
+			}
+			if want := api.ConputeHash(content); metadata.ContentHash != want {
+				t.Errorf("ContentHash = %s, want %s", metadata.ContentHash, want)
+			}
+			if got := localFiles(t, filepath.Dir(osPath)); len(got) != 1 {
+				t.Errorf("%d files in the target folder, want only the download", len(got))
+			}
+		})
+	}
+}
+
+// interruptingTransport -records the Range headers of downloads and breaks the next download after a number of bytes
+type interruptingTransport struct {
+	base      http.RoundTripper
+	mutex     sync.Mutex
+	interrupt int64 // 0: no interruption
+	ranges    []string
+}
+
+func (t *interruptingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != endpointDownload {
+		return t.base.RoundTrip(req)
+	}
+	t.mutex.Lock()
+	t.ranges = append(t.ranges, req.Header.Get("Range"))
+	interrupt := t.interrupt
+	t.interrupt = 0
+	t.mutex.Unlock()
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && interrupt > 0 {
+		resp.Body = &brokenBody{Reader: io.LimitReader(resp.Body, interrupt), Closer: resp.Body}
+	}
+	return resp, err
+}
+
+// brokenBody -a connection lost after the bytes of the reader
+type brokenBody struct {
+	io.Reader
+	io.Closer
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestDownloadResume(t *testing.T) {
+	const size = 100000
+	const interrupt = 30000
+	tests := []struct {
+		name       string
+		changed    []byte // new content of the remote file before the download is resumed, nil: unchanged
+		wantRanges []string
+	}{
+		{"unchanged file continues", nil, []string{"", "bytes=30000-"}},
+		{"changed file starts again", bytes.Repeat([]byte("x"), size), []string{"", "bytes=30000-", ""}},
+		{"shorter file starts again", []byte("short"), []string{"", "bytes=30000-", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			transport := &interruptingTransport{base: s.Client().Transport, interrupt: interrupt}
+			c.SetHTTPClient(&http.Client{Transport: transport})
+			s.AddFile("/file.bin", testContent(size))
+			osPath := filepath.Join(t.TempDir(), "file.bin")
+			ctx := context.Background()
+			if _, err := c.DownloadToFile(ctx, "/file.bin", osPath, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("interrupted download: error = %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+			if _, err := os.Stat(osPath); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("target of an interrupted download exists, error = %v", err)
+			}
+			remote := testContent(size)
+			if tt.changed != nil {
+				remote = tt.changed
+				s.AddFile("/file.bin", remote)
+			}
+			var reported int64
+			metadata, err := c.DownloadToFile(ctx, "/file.bin", osPath, func(transferred, _ int64) {
+				reported = transferred
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(osPath); !bytes.Equal(got, remote) {
+				t.Errorf("downloaded %d bytes, want %d", len(got), len(remote))
+			}
+			if reported != int64(len(remote)) {
+				t.Errorf("progress = %d, want %d", reported, len(remote))
+			}
+			if want := api.ConputeHash(remote); metadata.ContentHash != want {
+				t.Errorf("ContentHash = %s, want %s", metadata.ContentHash, want)
+			}
+			if !slices.Equal(transport.ranges, tt.wantRanges) {
+				t.Errorf("Range headers = %q, want %q", transport.ranges, tt.wantRanges)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(osPath)); len(entries) != 1 {
+				t.Errorf("%d files in the target folder, want only the download", len(entries))
+			}
+		})
+	}
+}
+
+func TestDownloadToFileWithStrategy(t *testing.T) {
+	remote := []byte("remote content")
+	local := []byte("local content")
+	tests := []struct {
+		name        string
+		existing    []byte // nil: no local file
+		folder      bool   // a local folder is in the way
+		strategy    string
+		wantSkipped bool
+		wantErr     error
+		wantFiles   map[string][]byte // local files afterwards
+	}{
+		{"no local file", nil, false, assets.OptUpdate, false, nil,
+			map[string][]byte{"file.txt": remote}},
+		{"identical file", remote, false, assets.OptUpdate, true, nil,
+			map[string][]byte{"file.txt": remote}},
+		{"update", local, false, assets.OptUpdate, false, nil,
+			map[string][]byte{"file.txt": remote}},
+		{"skip", local, false, assets.OptSkip, true, nil,
+			map[string][]byte{"file.txt": local}},
+		{"keep both", local, false, assets.OptKeepBoth, false, nil,
+			map[string][]byte{"file.txt": local, "file (1).txt": remote}},
+		{"update folder", nil, true, assets.OptUpdate, false, api.ErrConflict,
+			map[string][]byte{}},
+		{"skip folder", nil, true, assets.OptSkip, true, nil,
+			map[string][]byte{}},
+		{"keep both folder", nil, true, assets.OptKeepBoth, false, nil,
+			map[string][]byte{"file (1).txt": remote}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/file.txt", remote)
+			c.SetExistingFilesStrategy(tt.strategy)
+			dir := t.TempDir()
+			osPath := filepath.Join(dir, "file.txt")
+			if tt.existing != nil {
+				if err := os.WriteFile(osPath, tt.existing, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.folder {
+				if err := os.Mkdir(osPath, os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, skipped, err := c.DownloadToFileWithStrategy(context.Background(), "/file.txt", osPath, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("skipped = %v, want %v", skipped, tt.wantSkipped)
+			}
+			if got := localFiles(t, dir); !filesEqual(got, tt.wantFiles) {
+				t.Errorf("local files = %q, want %q", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestDownloadFolderWithStrategy(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  string
+		wantFiles map[string][]byte
+	}{
+		{"update", assets.OptUpdate, map[string][]byte{
+			"folder/a.txt": []byte("remote a"), "folder/sub/b.txt": []byte("remote b"), "folder/c.txt": []byte("local c"),
+		}},
+		{"skip", assets.OptSkip, map[string][]byte{
+			"folder/a.txt": []byte("local a"), "folder/sub/b.txt": []byte("remote b"), "folder/c.txt": []byte("local c"),
+		}},
+		{"keep both", assets.OptKeepBoth, map[string][]byte{
+			"folder/a.txt": []byte("local a"), "folder/a (1).txt": []byte("remote a"),
+			"folder/sub/b.txt": []byte("remote b"), "folder/c.txt": []byte("local c"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/folder/a.txt", []byte("remote a"))
+			s.AddFile("/folder/sub/b.txt", []byte("remote b"))
+			c.SetExistingFilesStrategy(tt.strategy)
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, "folder"), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range map[string]string{"folder/a.txt": "local a", "folder/c.txt": "local c"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := c.DownloadFolder(context.Background(), "/folder", dir, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := localFiles(t, dir); !filesEqual(got, tt.wantFiles) {
+				t.Errorf("local files = %q, want %q", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestDownloadFolderKeepsUnchanged(t *testing.T) {
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, strategy := range []string{assets.OptUpdate, assets.OptSkip, assets.OptKeepBoth} {
+		t.Run(strategy, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/folder/a.txt", []byte("remote a"))
+			s.AddFile("/folder/sub/b.txt", []byte("remote b"))
+			c.SetExistingFilesStrategy(strategy)
+			dir := t.TempDir()
+			osPath := filepath.Join(dir, "folder", "a.txt")
+			if err := os.Mkdir(filepath.Dir(osPath), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(osPath, []byte("remote a"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(osPath, old, old); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.DownloadFolder(context.Background(), "/folder", dir, nil); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string][]byte{"folder/a.txt": []byte("remote a"), "folder/sub/b.txt": []byte("remote b")}
+			if got := localFiles(t, dir); !filesEqual(got, want) {
+				t.Errorf("local files = %q, want %q", got, want)
+			}
+			if stat, err := os.Stat(osPath); err != nil || !stat.ModTime().Equal(old) {
+				t.Errorf("unchanged file has been written again, error %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadZipToFileWithStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		wantZips []string
+	}{
+		{"update", assets.OptUpdate, []string{"folder.zip"}},
+		{"skip", assets.OptSkip, nil},
+		{"keep both", assets.OptKeepBoth, []string{"folder (1).zip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/folder/a.txt", []byte("remote a"))
+			c.SetExistingFilesStrategy(tt.strategy)
+			dir := t.TempDir()
+			osPath := filepath.Join(dir, "folder.zip")
+			if err := os.WriteFile(osPath, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.DownloadZipToFile(context.Background(), "/folder", osPath, nil); err != nil {
+				t.Fatal(err)
+			}
+			var zips []string
+			for name, content := range localFiles(t, dir) {
+				if !bytes.Equal(content, []byte("old")) {
+					zips = append(zips, name)
+				}
+			}
+			slices.Sort(zips)
+			if !slices.Equal(zips, tt.wantZips) {
+				t.Errorf("downloaded archives = %q, want %q", zips, tt.wantZips)
+			}
+		})
+	}
+}
+
+// localFiles -content of the files below dir by slash separated relative path
+func localFiles(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(osPath string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, osPath)
+		if err == nil {
+			files[filepath.ToSlash(rel)], err = os.ReadFile(osPath)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func filesEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, content := range a {
+		if other, ok := b[name]; !ok || !bytes.Equal(content, other) {
+			return false
+		}
+	}
+	return true
+}
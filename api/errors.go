@@ -0,0 +1,147 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Dropbox errors
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"Dropbox_REST_Client/assets"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Common error cases, match with errors.Is
+var (
+	ErrNotFound           = errors.New(assets.ErrorNotFound)
+	ErrConflict           = errors.New(assets.ErrorConflict)
+	ErrInsufficientSpace  = errors.New(assets.ErrorInsufficientSpace)
+	ErrRateLimited        = errors.New(assets.ErrorRateLimited)
+	ErrInvalidAccessToken = errors.New(assets.ErrorInvalidAccessToken)
+)
+
+const maxTagDepth = 10 // safety net for malformed error bodies
+
+// DropboxError -decoded error answer of a Dropbox call
+type DropboxError struct {
+	StatusCode  int      // http status
+	Route       string   // endpoint, e.g. "/2/files/move_v2"
+	Summary     string   // error_summary, or OAuth error and description
+	Tags        []string // tag path of the error union from outer to inner, e.g. "to", "conflict", "folder"
+	UserMessage string   // localized message meant for the user, may be empty
+}
+
+// newDropboxError -decode the body of a failed call, handles API unions, OAuth errors and plain text answers
+func newDropboxError(status int, rawURL string, body []byte) *DropboxError {
+	var dbxerror ErrorType
+	var oauthError string
+	e := &DropboxError{StatusCode: status}
+	if u, err := url.Parse(rawURL); err == nil {
+		e.Route = u.Path
+	}
+	if json.Unmarshal(body, &dbxerror) != nil {
+		e.Summary = strings.TrimSpace(string(body))
+		return e
+	}
+	e.UserMessage = dbxerror.UserMessage.Text
+	if json.Unmarshal(dbxerror.Error, &oauthError) == nil {
+		// OAuth: "error" is a plain string
+		e.Tags = []string{oauthError}
+		e.Summary = strings.TrimSpace(oauthError + " " + dbxerror.ErrorDescription)
+		return e
+	}
+	e.Summary = dbxerror.ErrorSummary
+	e.Tags = unionTags(dbxerror.Error)
+	if len(e.Tags) == 0 {
+		e.Tags = summaryTags(dbxerror.ErrorSummary)
+	}
+	if e.Summary == "" {
+		e.Summary = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// newEntryError -error of a single failed entry of a batch, decoded like the error union of a failed call
+func newEntryError(failure json.RawMessage) *DropboxError {
+	tags := unionTags(failure)
+	return &DropboxError{StatusCode: http.StatusConflict, Summary: strings.Join(tags, DbxPathSeparator), Tags: tags}
+}
+
+// unionTags -follow the ".tag" chain of a tagged union, descending into the tagged member or "reason"
+func unionTags(raw json.RawMessage) []string {
+	var tags []string
+	for i := 0; i < maxTagDepth && len(raw) > 0; i++ {
+		var union map[string]json.RawMessage
+		var tag string
+		if json.Unmarshal(raw, &union) != nil {
+			break
+		}
+		_ = json.Unmarshal(union[".tag"], &tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+		if next, ok := union[tag]; ok && tag != "" {
+			raw = next
+		} else {
+			raw = union["reason"]
+		}
+	}
+	return tags
+}
+
+// summaryTags -tag path from an error_summary like "path/not_found/..."
+func summaryTags(summary string) []string {
+	var tags []string
+	for _, part := range strings.Split(summary, DbxPathSeparator) {
+		part = strings.TrimSpace(part)
+		if part == "" || strings.HasPrefix(part, ".") {
+			break
+		}
+		tags = append(tags, part)
+	}
+	return tags
+}
+
+func (e *DropboxError) Error() string {
+	if e.Summary != "" {
+		return e.Summary
+	}
+	return http.StatusText(e.StatusCode)
+}
+
+// HasTag -check whether tag occurs anywhere in the tag path
+func (e *DropboxError) HasTag(tag string) bool {
+	return slices.Contains(e.Tags, tag)
+}
+
+// Message -text to present to the user, the Dropbox user message if there is one
+func (e *DropboxError) Message() string {
+	if e.UserMessage != "" {
+		return e.UserMessage
+	}
+	return e.Error()
+}
+
+// Is -support errors.Is for the common error cases
+func (e *DropboxError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.HasTag("not_found")
+	case ErrConflict:
+		return e.HasTag("conflict")
+	case ErrInsufficientSpace:
+		return e.HasTag("insufficient_space")
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || e.HasTag("too_many_requests") ||
+			e.HasTag("too_many_write_operations")
+	case ErrInvalidAccessToken:
+		// a revoked refresh token (invalid_grant) needs the same recovery: authorize the app again
+		return e.StatusCode == http.StatusUnauthorized || e.HasTag("invalid_access_token") ||
+			e.HasTag("expired_access_token") || e.HasTag("invalid_grant")
+	}
+	return false
+}
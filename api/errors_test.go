@@ -0,0 +1,167 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - Dropbox errors
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/api/dbxtest"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestDropboxError(t *testing.T) {
+	sentinels := []error{api.ErrNotFound, api.ErrConflict, api.ErrInsufficientSpace, api.ErrRateLimited,
+		api.ErrInvalidAccessToken}
+	tests := []struct {
+		name       string
+		call       func(ctx context.Context, c *api.Client) error
+		prepare    func(c *api.Client)
+		wantStatus int
+		wantRoute  string
+		wantTags   []string
+		wantIs     error // the only sentinel matched, nil for none
+	}{
+		{
+			name: "not found",
+			call: func(ctx context.Context, c *api.Client) error {
+				_, err := c.GetMetadata(ctx, "/missing.txt")
+				return err
+			},
+			wantStatus: http.StatusConflict,
+			wantRoute:  "/2/files/get_metadata",
+			wantTags:   []string{"path", "not_found"},
+			wantIs:     api.ErrNotFound,
+		},
+		{
+			name: "move source not found",
+			call: func(ctx context.Context, c *api.Client) error {
+				_, err := c.MoveFiles(ctx, "/missing.txt", "/b.txt")
+				return err
+			},
+			wantStatus: http.StatusConflict,
+			wantRoute:  "/2/files/move_v2",
+			wantTags:   []string{"from_lookup", "not_found"},
+			wantIs:     api.ErrNotFound,
+		},
+		{
+			name: "file in the way of a folder",
+			call: func(ctx context.Context, c *api.Client) error {
+				_, err := c.EnsureFolder(ctx, "/a.txt")
+				return err
+			},
+			wantStatus: http.StatusConflict,
+			wantRoute:  "/2/files/create_folder_v2",
+			wantTags:   []string{"path", "conflict", "file"},
+			wantIs:     api.ErrConflict,
+		},
+		{
+			name: "revoked refresh token",
+			prepare: func(c *api.Client) {
+				c.SetConnectionData(api.AppAuthType{AppKey: dbxtest.AppKey, AppSecret: dbxtest.AppSecret}, "revoked")
+			},
+			call: func(ctx context.Context, c *api.Client) error {
+				_, err := c.GetMetadata(ctx, "/a.txt")
+				return err
+			},
+			wantStatus: http.StatusBadRequest,
+			wantRoute:  "/oauth2/token",
+			wantTags:   []string{"invalid_grant"},
+			wantIs:     api.ErrInvalidAccessToken,
+		},
+		{
+			name: "wrong app secret",
+			prepare: func(c *api.Client) {
+				c.SetConnectionData(api.AppAuthType{AppKey: dbxtest.AppKey, AppSecret: "wrong"}, dbxtest.RefreshToken)
+			},
+			call: func(ctx context.Context, c *api.Client) error {
+				_, err := c.GetMetadata(ctx, "/a.txt")
+				return err
+			},
+			wantStatus: http.StatusBadRequest,
+			wantRoute:  "/oauth2/token",
+			wantTags:   []string{"invalid_client"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/a.txt", []byte("a"))
+			s.AddFolder("/folder")
+			if tt.prepare != nil {
+				tt.prepare(c)
+			}
+			err := tt.call(context.Background(), c)
+			var dbxerr *api.DropboxError
+			if !errors.As(err, &dbxerr) {
+				t.Fatalf("error = %v, want a DropboxError", err)
+			}
+			if dbxerr.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", dbxerr.StatusCode, tt.wantStatus)
+			}
+			if dbxerr.Route != tt.wantRoute {
+				t.Errorf("Route = %q, want %q", dbxerr.Route, tt.wantRoute)
+			}
+			if !slices.Equal(dbxerr.Tags, tt.wantTags) {
+				t.Errorf("Tags = %q, want %q", dbxerr.Tags, tt.wantTags)
+			}
+			if dbxerr.Message() == "" {
+				t.Error("Message() is empty")
+			}
+			for _, sentinel := range sentinels {
+				if got, want := errors.Is(err, sentinel), sentinel == tt.wantIs; got != want {
+					t.Errorf("errors.Is(err, %v) = %v, want %v", sentinel, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDropboxErrorPlainText(t *testing.T) {
+	s, c := newTestServer(t)
+	s.InjectFailure("/2/files/move_v2", http.StatusBadGateway, 1)
+	_, err := c.MoveFiles(context.Background(), "/a.txt", "/b.txt")
+	var dbxerr *api.DropboxError
+	if !errors.As(err, &dbxerr) {
+		t.Fatalf("error = %v, want a DropboxError", err)
+	}
+	if dbxerr.StatusCode != http.StatusBadGateway || dbxerr.Summary != http.StatusText(http.StatusBadGateway) ||
+		len(dbxerr.Tags) != 0 {
+		t.Errorf("error = %+v, want the plain text answer", *dbxerr)
+	}
+}
+
+func TestBatchEntryError(t *testing.T) {
+	s, c := newTestServer(t)
+	s.AddFolder("/folder")
+	result, err := c.BatchMoveFiles(context.Background(), []api.RelocationPathType{
+		{FromPath: "/missing.txt", ToPath: "/folder/missing.txt"},
+		{FromPath: "/folder", ToPath: "/folder/sub"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		tag string
+		is  error
+	}{
+		{"not_found", api.ErrNotFound},
+		{"cant_move_folder_into_itself", nil},
+	}
+	if len(result.Entries) != len(want) {
+		t.Fatalf("entries = %d, want %d", len(result.Entries), len(want))
+	}
+	for i, entry := range result.Entries {
+		var dbxerr *api.DropboxError
+		if err := entry.Err(); !errors.As(err, &dbxerr) || !dbxerr.HasTag(want[i].tag) {
+			t.Errorf("entry %d: error = %v, want tag %s", i, err, want[i].tag)
+		} else if want[i].is != nil && !errors.Is(err, want[i].is) {
+			t.Errorf("entry %d: error = %v, want %v", i, err, want[i].is)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - transfers honouring the existing files strategy
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"Dropbox_REST_Client/assets"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// UploadLocalFileWithStrategy -upload a local file, an existing Dropbox file with identical content is kept,
+// otherwise the existing files strategy decides, skipped is true if nothing was uploaded
+func (c *Client) UploadLocalFileWithStrategy(ctx context.Context, osPath string, path string,
+	progress ProgressFunc) (metadata *FileItemType, skipped bool, err error) {
+	return c.UploadLocalFileResumable(ctx, osPath, path, nil, nil, progress)
+}
+
+// UploadLocalFileResumable -UploadLocalFileWithStrategy, files larger than the upload chunk size continue the
+// upload session in resume if the local file is unchanged, checkpoint receives the state to persist after every chunk
+func (c *Client) UploadLocalFileResumable(ctx context.Context, osPath string, path string, resume *UploadResumeType,
+	checkpoint func(UploadResumeType), progress ProgressFunc) (metadata *FileItemType, skipped bool, err error) {
+	commit := CommitInfoType{Mode: WriteModeType{Tag: Add}, Path: path}
+	remote, err := c.GetMetadata(ctx, path)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, false, err
+	case remote.Tag != DbxFile:
+		// a folder is never replaced, Add fails with a conflict unless both are kept
+		commit.AutoRename = c.ExistingFilesStrategy() == assets.OptKeepBoth
+	default:
+		hash, err := c.hashFile(ctx, osPath)
+		if err != nil {
+			return nil, false, err
+		}
+		if hash == remote.ContentHash {
+			return remote, true, nil
+		}
+		switch c.ExistingFilesStrategy() {
+		case assets.OptSkip:
+			return remote, true, nil
+		case assets.OptKeepBoth:
+			commit.AutoRename = true
+		default:
+			// fails with a conflict if the file has been changed by someone else in the meantime
+			commit.Mode = WriteModeType{Tag: Update, Rev: remote.Rev}
+		}
+	}
+	f, err := os.Open(osPath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if stat.Size() <= c.chunkSize() {
+		metadata, err = c.uploadCommit(ctx, commit, f, stat.Size(), progress)
+	} else {
+		metadata, err = c.uploadResumable(ctx, commit, f, stat, resume, checkpoint, progress)
+	}
+	return metadata, false, err
+}
+
+// DownloadToFileWithStrategy -download a file, an existing local file with identical content is kept,
+// otherwise the existing files strategy decides, skipped is true if nothing was downloaded
+func (c *Client) DownloadToFileWithStrategy(ctx context.Context, path string, osPath string,
+	progress ProgressFunc) (metadata *FileItemType, skipped bool, err error) {
+	stat, err := os.Stat(osPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		metadata, err = c.DownloadToFile(ctx, path, osPath, progress)
+		return metadata, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !stat.IsDir() {
+		remote, err := c.GetMetadata(ctx, path)
+		if err != nil {
+			return nil, false, err
+		}
+		hash, err := c.hashFile(ctx, osPath)
+		if err != nil {
+			return nil, false, err
+		}
+		if hash == remote.ContentHash {
+			return remote, true, nil
+		}
+	}
+	osPath, skipped, err = existingTarget(osPath, c.ExistingFilesStrategy())
+	if err != nil || skipped {
+		return nil, skipped, err
+	}
+	metadata, err = c.DownloadToFile(ctx, path, osPath, progress)
+	return metadata, false, err
+}
+
+// existingTarget -local file to write, the existing files strategy decides about an existing file or folder,
+// a folder is never replaced by a file, skip is true if nothing is to be written
+func existingTarget(osPath string, strategy string) (target string, skip bool, err error) {
+	stat, err := os.Stat(osPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return osPath, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case strategy == assets.OptSkip:
+		return "", true, nil
+	case strategy == assets.OptKeepBoth:
+		return AvailableName(osPath), false, nil
+	case stat.IsDir():
+		return "", false, fmt.Errorf("%s: %w", osPath, ErrConflict)
+	}
+	return osPath, false, nil
+}
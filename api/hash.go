@@ -0,0 +1,143 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Dropbox content hash, https://www.dropbox.com/developers/reference/content-hash
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+const hashBlockSize = 4 * 1024 * 1024
+
+// ContentHasher -hash.Hash computing the Dropbox content hash of the data written to it
+type ContentHasher struct {
+	block    hash.Hash // hash of the current 4 MiB block
+	blockLen int
+	sums     []byte // concatenated hashes of the finished blocks
+}
+
+var _ hash.Hash = (*ContentHasher)(nil)
+
+// NewContentHasher -create a content hasher, feed it e.g. with io.Copy
+func NewContentHasher() *ContentHasher {
+	return &ContentHasher{block: sha256.New()}
+}
+
+func (h *ContentHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(len(p), hashBlockSize-h.blockLen)
+		h.block.Write(p[:n])
+		h.blockLen += n
+		p = p[n:]
+		if h.blockLen == hashBlockSize {
+			h.sums = h.block.Sum(h.sums)
+			h.block.Reset()
+			h.blockLen = 0
+		}
+	}
+	return written, nil
+}
+
+// Sum -append the content hash of the data written so far to b
+func (h *ContentHasher) Sum(b []byte) []byte {
+	sums := h.sums
+	if h.blockLen > 0 {
+		sums = h.block.Sum(sums[:len(sums):len(sums)])
+	}
+	sum := sha256.Sum256(sums)
+	return append(b, sum[:]...)
+}
+
+func (h *ContentHasher) Reset() {
+	h.block.Reset()
+	h.blockLen = 0
+	h.sums = h.sums[:0]
+}
+
+func (h *ContentHasher) Size() int {
+	return sha256.Size
+}
+
+// BlockSize -writes of multiples of 4 MiB are the most efficient
+func (h *ContentHasher) BlockSize() int {
+	return hashBlockSize
+}
+
+// HexSum -content hash as hex string, the form used in the Dropbox metadata
+func (h *ContentHasher) HexSum() string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HashFile -content hash of a local file, the 4 MiB blocks are hashed in parallel on all CPU cores
+func HashFile(ctx context.Context, osPath string) (string, error) {
+	f, err := os.Open(osPath)
+	if err != nil {
+		return "", err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	blocks := int((stat.Size() + hashBlockSize - 1) / hashBlockSize)
+	sums := make([]byte, blocks*sha256.Size)
+	next := make(chan int)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.NumCPU(), blocks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buffer := make([]byte, hashBlockSize)
+			for i := range next {
+				offset := int64(i) * hashBlockSize
+				n, err := f.ReadAt(buffer[:min(stat.Size()-offset, hashBlockSize)], offset)
+				if err != nil && !(err == io.EOF && offset+int64(n) == stat.Size()) {
+					select {
+					case errs <- err:
+					default:
+					}
+					continue
+				}
+				sum := sha256.Sum256(buffer[:n])
+				copy(sums[i*sha256.Size:], sum[:])
+			}
+		}()
+	}
+feed:
+	for i := 0; i < blocks; i++ {
+		select {
+		case next <- i:
+		case err = <-errs:
+			break feed
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(sums)
+	return hex.EncodeToString(sum[:]), nil
+}
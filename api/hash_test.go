@@ -0,0 +1,85 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - Dropbox content hash
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+const hashBlock = 4 * 1024 * 1024
+
+// contentHashTests -expected hashes computed independently (Python hashlib) following
+// https://www.dropbox.com/developers/reference/content-hash, the hash of empty content is the SHA-256 of nothing
+var contentHashTests = []struct {
+	name    string
+	content []byte
+	want    string
+}{
+	{"empty", nil, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	{"abc", []byte("abc"), "4f8b42c22dd3729b519ba6f68d2da7cc5b2d606d05daed5ad5128cc03e6c6358"},
+	{"one block", testContent(hashBlock), "c3e676634f2ffa44c48012c2fd13cd98765cb5b9ccc35f3ff7363f3352d74c9f"},
+	{"one block and a byte", testContent(hashBlock + 1),
+		"b72986f16bd52c8d15f1eb0bb8433433ded7680313e86e903d8ea86b576a084f"},
+	{"two and a half blocks", testContent(hashBlock * 5 / 2),
+		"06a63998988b6a0fb0adf852ef097c9db6edeaf6b8186bcfb19d8e6a53a91e5a"},
+}
+
+func TestContentHasher(t *testing.T) {
+	for _, tt := range contentHashTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := api.ConputeHash(tt.content); got != tt.want {
+				t.Errorf("ConputeHash() = %s, want %s", got, tt.want)
+			}
+			// fed in odd pieces across the block boundaries
+			hasher := api.NewContentHasher()
+			if _, err := io.CopyBuffer(hasher, iotest.OneByteReader(bytes.NewReader(tt.content[:min(len(tt.content), 99)])),
+				make([]byte, 1)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.CopyBuffer(hasher, bytes.NewReader(tt.content[min(len(tt.content), 99):]),
+				make([]byte, 1000003)); err != nil {
+				t.Fatal(err)
+			}
+			if got := hasher.HexSum(); got != tt.want {
+				t.Errorf("ContentHasher = %s, want %s", got, tt.want)
+			}
+			if got := hasher.HexSum(); got != tt.want {
+				t.Errorf("second HexSum() = %s, want %s", got, tt.want)
+			}
+			hasher.Reset()
+			_, _ = hasher.Write(tt.content)
+			if got := hasher.HexSum(); got != tt.want {
+				t.Errorf("after Reset = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range contentHashTests {
+		t.Run(tt.name, func(t *testing.T) {
+			osPath := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(osPath, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := api.HashFile(context.Background(), osPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("HashFile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
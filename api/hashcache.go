@@ -0,0 +1,124 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Persistent cache of local content hashes
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// HashCacheType -content hashes of local files, an entry is valid as long as size, mtime and inode are unchanged
+type HashCacheType struct {
+	mutex   sync.Mutex
+	file    string
+	entries map[string]hashCacheEntryType // key: absolute path
+	dirty   bool
+}
+
+type hashCacheEntryType struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // nanoseconds since the epoch
+	Inode   uint64 `json:"inode"`
+	Hash    string `json:"hash"`
+}
+
+// LoadHashCache -read the cache from file, a missing or unreadable file gives an empty cache
+func LoadHashCache(file string) *HashCacheType {
+	hc := &HashCacheType{file: file, entries: make(map[string]hashCacheEntryType)}
+	if j, err := os.ReadFile(file); err == nil {
+		_ = json.Unmarshal(j, &hc.entries)
+	}
+	return hc
+}
+
+// Save -write the cache to its file if it has been changed
+func (hc *HashCacheType) Save() error {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	if !hc.dirty {
+		return nil
+	}
+	j, err := json.Marshal(hc.entries)
+	if err != nil {
+		return err
+	}
+	tmp := hc.file + partialFileSuffix
+	if err = os.WriteFile(tmp, j, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, hc.file); err != nil {
+		return err
+	}
+	hc.dirty = false
+	return nil
+}
+
+// HashFile -content hash of a local file, computed with HashFile if the cache has no valid entry
+func (hc *HashCacheType) HashFile(ctx context.Context, osPath string) (string, error) {
+	osPath, err := filepath.Abs(osPath)
+	if err != nil {
+		return "", err
+	}
+	before, err := os.Stat(osPath)
+	if err != nil {
+		return "", err
+	}
+	hc.mutex.Lock()
+	entry, ok := hc.entries[osPath]
+	hc.mutex.Unlock()
+	if ok && entry.matches(before) {
+		return entry.Hash, nil
+	}
+	hash, err := HashFile(ctx, osPath)
+	if err != nil {
+		return "", err
+	}
+	// a file changed while it was hashed is not cached
+	if after, err := os.Stat(osPath); err == nil && newHashCacheEntry(after, "").matches(before) {
+		hc.mutex.Lock()
+		hc.entries[osPath] = newHashCacheEntry(after, hash)
+		hc.dirty = true
+		hc.mutex.Unlock()
+	}
+	return hash, nil
+}
+
+// Prune -remove the entries of deleted or changed files, returns the number of removed entries
+func (hc *HashCacheType) Prune() int {
+	var removed int
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	for osPath, entry := range hc.entries {
+		stat, err := os.Stat(osPath)
+		if errors.Is(err, fs.ErrNotExist) || (err == nil && !entry.matches(stat)) {
+			delete(hc.entries, osPath)
+			removed++
+		}
+	}
+	if removed > 0 {
+		hc.dirty = true
+	}
+	return removed
+}
+
+func newHashCacheEntry(stat os.FileInfo, hash string) hashCacheEntryType {
+	return hashCacheEntryType{
+		Size:    stat.Size(),
+		ModTime: stat.ModTime().UnixNano(),
+		Inode:   fileInode(stat),
+		Hash:    hash,
+	}
+}
+
+func (e hashCacheEntryType) matches(stat os.FileInfo) bool {
+	return !stat.IsDir() && e.Size == stat.Size() && e.ModTime == stat.ModTime().UnixNano() &&
+		e.Inode == fileInode(stat)
+}
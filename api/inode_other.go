@@ -0,0 +1,15 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// File identity for the hash cache
+// ---------------------------------------------------------------------------------------------------------------------
+
+//go:build !unix
+
+package api
+
+import "os"
+
+// fileInode -not available, size and mtime only
+func fileInode(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,21 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// File identity for the hash cache
+// ---------------------------------------------------------------------------------------------------------------------
+
+//go:build unix
+
+package api
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode -inode number, detects files replaced by a different file with the same size and mtime
+func fileInode(stat os.FileInfo) uint64 {
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		return uint64(sys.Ino)
+	}
+	return 0
+}
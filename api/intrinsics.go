@@ -6,14 +6,22 @@
 package api
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 // Dropbox URIs
@@ -23,18 +31,43 @@ const (
 	dropboxContentURI = "https://content.dropbox.com"
 )
 
+// Environment variables overriding the Dropbox URIs, e.g. to run against a local stand-in server
+const (
+	EnvAuthURI    = "DROPBOX_AUTH_URI"
+	EnvAPIURI     = "DROPBOX_API_URI"
+	EnvContentURI = "DROPBOX_CONTENT_URI"
+)
+
 // Dropbox REST API endpoints
 const (
-	endpointAuthToken             = "/oauth2/token"
-	endpointGetCurrentUser        = "/2/users/get_current_account"
-	endpointListFolder            = "/2/files/list_folder"
-	endpointListFolderContinue    = "/2/files/list_folder/continue"
-	endPointFilesMove             = "/2/files/move_v2"
-	endPointFilesDelete           = "/2/files/delete_v2"
-	endPointFilesDeleteBatch      = "/2/files/delete_batch"
-	endPointFilesDeleteBatchCheck = "/2/files/delete_batch/check"
-	endPointCreateFolder          = "/2/files/create_folder_v2"
-	endPointFilesUpload           = "/2/files/upload"
+	endpointAuthToken              = "/oauth2/token"
+	endpointGetCurrentUser         = "/2/users/get_current_account"
+	endpointListFolder             = "/2/files/list_folder"
+	endpointListFolderContinue     = "/2/files/list_folder/continue"
+	endPointFilesMove              = "/2/files/move_v2"
+	endPointFilesMoveBatch         = "/2/files/move_batch_v2"
+	endPointFilesMoveBatchCheck    = "/2/files/move_batch/check_v2"
+	endPointFilesDelete            = "/2/files/delete_v2"
+	endPointGetMetadata            = "/2/files/get_metadata"
+	endPointListRevisions          = "/2/files/list_revisions"
+	endPointRestore                = "/2/files/restore"
+	endPointPermanentlyDelete      = "/2/files/permanently_delete"
+	endPointSearch                 = "/2/files/search_v2"
+	endPointSearchContinue         = "/2/files/search/continue_v2"
+	endPointFilesDeleteBatch       = "/2/files/delete_batch"
+	endPointFilesDeleteBatchCheck  = "/2/files/delete_batch/check"
+	endPointFilesCopy              = "/2/files/copy_v2"
+	endPointFilesCopyBatch         = "/2/files/copy_batch_v2"
+	endPointFilesCopyBatchCheck    = "/2/files/copy_batch/check_v2"
+	endPointCreateFolder           = "/2/files/create_folder_v2"
+	endPointCreateFolderBatch      = "/2/files/create_folder_batch"
+	endPointCreateFolderBatchCheck = "/2/files/create_folder_batch/check"
+	endPointFilesUpload            = "/2/files/upload"
+	endPointUploadSessionStart     = "/2/files/upload_session/start"
+	endPointUploadSessionAppend    = "/2/files/upload_session/append_v2"
+	endPointUploadSessionFinish    = "/2/files/upload_session/finish"
+	endPointFilesDownload          = "/2/files/download"
+	endPointFilesDownloadZip       = "/2/files/download_zip"
 )
 
 const (
@@ -50,6 +83,8 @@ const (
 	paraCode          = "code"
 	paraRefreshToken  = "refresh_token"
 	paraDbxAPIArg     = "Dropbox-API-Arg"
+	paraDbxAPIResult  = "Dropbox-API-Result"
+	paraRange         = "Range"
 )
 
 const (
@@ -62,10 +97,14 @@ const (
 const (
 	DbxFile                     = "file"
 	DbxFolder                   = "folder"
+	DbxDeleted                  = "deleted"
 	DbxPathSeparator            = "/"
 	DbxInvalidCharacters string = "/\\<>:\"|?*"
 	DbxReplaceBySubst           = "_"
 	DbxMaxUploadFileSize int64  = 150 * 1024 * 1024
+	DbxUploadChunkUnit   int64  = 4 * 1024 * 1024   // upload session chunks must be multiples of this
+	DbxMaxUploadChunk    int64  = 148 * 1024 * 1024 // largest multiple of 4 MiB below the request size limit
+	defaultUploadChunk   int64  = 16 * 1024 * 1024
 )
 
 // Async job results
@@ -74,12 +113,26 @@ const (
 	DbxComplete   = "complete"
 	DbxFailed     = "failed"
 	DbxAsyncJobId = "async_job_id"
-	maxJobPolls   = 10 // number of polls for async job
-	pollSleepTime = 3  // sleep time till next poll
+)
+
+// Async job poll defaults
+const (
+	defaultPollInterval    = 500 * time.Millisecond
+	defaultMaxPollInterval = 10 * time.Second
+	defaultPollFactor      = 1.5
 )
 
 const threshold = 10 // safety time span for requesting new access token
 
+// Retry defaults
+const (
+	defaultMaxRetries = 4
+	defaultBaseDelay  = 1 * time.Second
+	defaultMaxDelay   = 60 * time.Second
+)
+
+const paraRetryAfter = "Retry-After"
+
 type AppAuthType struct {
 	AppKey    string
 	AppSecret string
@@ -91,17 +144,47 @@ type accessTokenType struct {
 	fetchedAt int64
 }
 
+// EndpointsType -base URIs for authorization, API and content calls, empty values fall back to the Dropbox defaults
+type EndpointsType struct {
+	AuthURI    string
+	APIURI     string
+	ContentURI string
+}
+
 type KeyValueType struct {
 	Key   string
 	Value string
 }
 
 type RESTParaType struct {
-	ParaURL    string
-	ParaMethod string
-	ParaHeader []KeyValueType
-	ParaForm   url.Values
-	ParaBody   []byte //string
+	ParaURL        string
+	ParaMethod     string
+	ParaHeader     []KeyValueType
+	ParaForm       url.Values
+	ParaBody       []byte           //string
+	ParaIdempotent bool             // call may be repeated after server errors and network failures
+	ParaProgress   func(sent int64) // called while the body is sent, from the http transport's goroutine
+	ParaUpload     bool             // the body is file content, throttled by the upload limits
+	ParaDownload   bool             // the response is file content, throttled by the download limits
+}
+
+// ProgressFunc -reports the bytes transferred so far of total, may be called from any goroutine
+type ProgressFunc func(transferred, total int64)
+
+// RetryPolicyType -how often and how long restCall waits before repeating a failed call,
+// rate limited calls are always retried, server errors and network failures only for idempotent calls
+type RetryPolicyType struct {
+	MaxRetries int
+	BaseDelay  time.Duration // first backoff, doubled with every retry
+	MaxDelay   time.Duration // upper bound of the backoff
+}
+
+// PollPolicyType -how long to wait between two checks of an async job, the interval grows by Factor from
+// Interval up to MaxInterval, a job is polled until it is done or the context of the call ends
+type PollPolicyType struct {
+	Interval    time.Duration
+	MaxInterval time.Duration
+	Factor      float64
 }
 
 type DbxWriteMode string
@@ -112,11 +195,27 @@ const (
 	Update    DbxWriteMode = "update"
 )
 
+// WriteModeType -write mode union, Rev is the revision to be replaced and only used with Update
+type WriteModeType struct {
+	Tag DbxWriteMode
+	Rev string
+}
+
+func (m WriteModeType) MarshalJSON() ([]byte, error) {
+	if m.Tag == Update {
+		return json.Marshal(struct {
+			Tag    DbxWriteMode `json:".tag"`
+			Update string       `json:"update"`
+		}{m.Tag, m.Rev})
+	}
+	return json.Marshal(string(m.Tag))
+}
+
 type contentType string
 
 const (
 	valContentTypeURLForm     contentType = "application/x-www-form-urlencoded"
-	valContentTypeOctetStream contentType = "application/octet-steam"
+	valContentTypeOctetStream contentType = "application/octet-stream"
 	valContentTypeJson        contentType = "application/json"
 )
 
@@ -150,6 +249,47 @@ type FilesMoveParaType struct {
 	ToPath                 string `json:"to_path"`
 }
 
+type ListRevisionsParaType struct {
+	Path  string `json:"path"`
+	Mode  string `json:"mode"`
+	Limit uint64 `json:"limit"`
+}
+
+type RestoreParaType struct {
+	Path string `json:"path"`
+	Rev  string `json:"rev"`
+}
+
+// TagType -member of a union without fields
+type TagType struct {
+	Tag string `json:".tag"`
+}
+
+// SearchOptionsType -scope of a search, Path "" is the whole Dropbox, MaxResults the page size (1 - 1000),
+// FileExtensions without dot, FileCategories e.g. DbxCategoryImage
+type SearchOptionsType struct {
+	Path           string    `json:"path,omitempty"`
+	MaxResults     uint64    `json:"max_results,omitempty"`
+	FilenameOnly   bool      `json:"filename_only"`
+	FileExtensions []string  `json:"file_extensions,omitempty"`
+	FileCategories []TagType `json:"file_categories,omitempty"`
+}
+
+type SearchParaType struct {
+	Query   string            `json:"query"`
+	Options SearchOptionsType `json:"options"`
+}
+
+type RelocationPathType struct {
+	FromPath string `json:"from_path"`
+	ToPath   string `json:"to_path"`
+}
+
+type RelocationBatchParaType struct {
+	Entries    []RelocationPathType `json:"entries"`
+	Autorename bool                 `json:"autorename"`
+}
+
 type FilePathParaType struct {
 	Path string `json:"path"`
 }
@@ -168,15 +308,53 @@ type CreateFolderParaType struct {
 	Path       string `json:"path"`
 }
 
+type CreateFolderBatchParaType struct {
+	Paths      []string `json:"paths"`
+	Autorename bool     `json:"autorename"`
+}
+
 type UploadFileParaType struct {
 	AutoRename     bool                `json:"autorename"`
-	Mode           DbxWriteMode        `json:"mode"`
+	Mode           WriteModeType       `json:"mode"`
 	Path           string              `json:"path"`
-	ClientModified string              `json:"client_modified"`
+	ClientModified string              `json:"client_modified,omitempty"`
 	Mute           bool                `json:"mute"`
-	PropertyGroups []PropertyGroupType `json:"property_groups"`
+	PropertyGroups []PropertyGroupType `json:"property_groups,omitempty"`
 	StrictConflict bool                `json:"strict_conflict"`
-	ContentHash    string              `json:"content_hash"`
+	ContentHash    string              `json:"content_hash,omitempty"`
+}
+
+type UploadSessionStartParaType struct {
+	Close bool `json:"close"`
+}
+
+type UploadSessionStartType struct {
+	SessionId string `json:"session_id"`
+}
+
+type UploadSessionCursorType struct {
+	SessionId string `json:"session_id"`
+	Offset    int64  `json:"offset"`
+}
+
+type UploadSessionAppendParaType struct {
+	Cursor UploadSessionCursorType `json:"cursor"`
+	Close  bool                    `json:"close"`
+}
+
+type CommitInfoType struct {
+	AutoRename     bool          `json:"autorename"`
+	Mode           WriteModeType `json:"mode"`
+	Path           string        `json:"path"`
+	ClientModified string        `json:"client_modified,omitempty"`
+	Mute           bool          `json:"mute"`
+	StrictConflict bool          `json:"strict_conflict"`
+}
+
+type UploadSessionFinishParaType struct {
+	Cursor      UploadSessionCursorType `json:"cursor"`
+	Commit      CommitInfoType          `json:"commit"`
+	ContentHash string                  `json:"content_hash,omitempty"`
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -197,9 +375,16 @@ type UserMessageType struct {
 	Locale string `json:"locale"`
 }
 
+type RateLimitErrorType struct {
+	Reason struct {
+		Tag string `json:".tag"`
+	} `json:"reason"`
+	RetryAfter int64 `json:"retry_after"`
+}
+
 type ErrorType struct {
 	ErrorSummary     string          `json:"error_summary"`
-	Error            string          `json:"error"`
+	Error            json.RawMessage `json:"error"` // tagged union, plain string for OAuth errors
 	ErrorDescription string          `json:"error_description"`
 	UserMessage      UserMessageType `json:"user_message"`
 }
@@ -296,6 +481,29 @@ type FileItemMetadataType struct {
 	Metadata FileItemType `json:"metadata"`
 }
 
+type DownloadZipResultType struct {
+	Metadata FileItemType `json:"metadata"`
+}
+
+// RevisionsType -revisions of a file, newest first
+type RevisionsType struct {
+	IsDeleted     bool           `json:"is_deleted"`
+	ServerDeleted string         `json:"server_deleted"`
+	Entries       []FileItemType `json:"entries"`
+}
+
+// SearchMatchType -a file or folder found, MatchType is filename, file_content or both
+type SearchMatchType struct {
+	Metadata  FileItemMetadataType `json:"metadata"`
+	MatchType TagType              `json:"match_type"`
+}
+
+type SearchResultType struct {
+	Matches []SearchMatchType `json:"matches"`
+	HasMore bool              `json:"has_more"`
+	Cursor  string            `json:"cursor"`
+}
+
 type ItemInfoType struct {
 	Cursor  string         `json:"cursor"`
 	Entries []FileItemType `json:"entries"`
@@ -308,49 +516,275 @@ type FileItemBatchDeletedType struct {
 	Entries    []FileItemMetadataType `json:"entries"`
 }
 
+func (r *FileItemBatchDeletedType) jobTag() string {
+	return r.Tag
+}
+
+func (r *FileItemBatchDeletedType) jobId() string {
+	return r.AsyncJobId
+}
+
+// RelocationBatchResultType -answer of the copy and move batch calls and their checks, entries in request order
+type RelocationBatchResultType struct {
+	Tag        string                     `json:".tag"`
+	AsyncJobId string                     `json:"async_job_id"`
+	Entries    []RelocationBatchEntryType `json:"entries"`
+}
+
+func (r *RelocationBatchResultType) jobTag() string {
+	return r.Tag
+}
+
+func (r *RelocationBatchResultType) jobId() string {
+	return r.AsyncJobId
+}
+
+// CreateFolderBatchResultType -answer of the create folder batch call and its checks, entries in request order
+type CreateFolderBatchResultType struct {
+	Tag        string                       `json:".tag"`
+	AsyncJobId string                       `json:"async_job_id"`
+	Entries    []CreateFolderBatchEntryType `json:"entries"`
+}
+
+func (r *CreateFolderBatchResultType) jobTag() string {
+	return r.Tag
+}
+
+func (r *CreateFolderBatchResultType) jobId() string {
+	return r.AsyncJobId
+}
+
+// CreateFolderBatchEntryType -result of a single folder, tagged success or failure
+type CreateFolderBatchEntryType struct {
+	Tag      string          `json:".tag"`
+	Metadata FileItemType    `json:"metadata"`
+	Failure  json.RawMessage `json:"failure"`
+}
+
+// Err -error of a failed entry, nil on success
+func (e CreateFolderBatchEntryType) Err() error {
+	if e.Tag == "success" {
+		return nil
+	}
+	return newEntryError(e.Failure)
+}
+
+// RelocationBatchEntryType -result of a single entry, tagged success or failure
+type RelocationBatchEntryType struct {
+	Tag     string          `json:".tag"`
+	Success FileItemType    `json:"success"`
+	Failure json.RawMessage `json:"failure"`
+}
+
+// Err -error of a failed entry, nil on success
+func (e RelocationBatchEntryType) Err() error {
+	if e.Tag == "success" {
+		return nil
+	}
+	return newEntryError(e.Failure)
+}
+
 //----------------------------------------------------------------------------------------------------------------------
 
-var authkey AppAuthType
-var accessToken accessTokenType
-var refreshToken string
-var existingFilesStrategy string
+// Client -connection to a single Dropbox account, owns credentials, token state, http client and base URIs
+type Client struct {
+	mutex                 sync.Mutex
+	refreshMutex          sync.Mutex // serializes access token refreshes, mutex is not held meanwhile
+	authkey               AppAuthType
+	accessToken           accessTokenType
+	refreshToken          string
+	credentials           int // changed with key, refresh token or endpoints, a token refreshed before is dropped
+	existingFilesStrategy string
+	httpClient            *http.Client
+	retryPolicy           RetryPolicyType
+	pollPolicy            PollPolicyType
+	uploadChunkSize       int64
+	hashCache             *HashCacheType
+	bandwidthMutex        sync.Mutex // guards bandwidth, separate so throttled reads do not contend with mutex
+	bandwidth             BandwidthType
+	uploadLimiter         limiterType
+	downloadLimiter       limiterType
+	authURI               string
+	apiURI                string
+	contentURI            string
+}
 
 //----------------------------------------------------------------------------------------------------------------------
 
-// SetConnectionData -receive connection data from ui
-func SetConnectionData(key AppAuthType, token string) {
-	authkey = key
-	refreshToken = token
+// NewClient -create a new client for the given app key/secret and refresh token
+func NewClient(key AppAuthType, token string) *Client {
+	c := &Client{
+		authkey:         key,
+		refreshToken:    token,
+		httpClient:      &http.Client{},
+		retryPolicy:     DefaultRetryPolicy(),
+		pollPolicy:      DefaultPollPolicy(),
+		uploadChunkSize: defaultUploadChunk,
+	}
+	c.SetEndpoints(DefaultEndpoints())
+	return c
 }
 
-// SetExistingFilesStrategy -either skip or update existing files (compare hashes)
-func SetExistingFilesStrategy(strategy string) {
-	existingFilesStrategy = strategy
+// DefaultRetryPolicy -retry policy of a new client
+func DefaultRetryPolicy() RetryPolicyType {
+	return RetryPolicyType{
+		MaxRetries: defaultMaxRetries,
+		BaseDelay:  defaultBaseDelay,
+		MaxDelay:   defaultMaxDelay,
+	}
+}
+
+// SetRetryPolicy -replace the retry policy, MaxRetries = 0 disables retries
+func (c *Client) SetRetryPolicy(policy RetryPolicyType) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.retryPolicy = policy
+}
+
+// DefaultEndpoints -the official Dropbox URIs
+func DefaultEndpoints() EndpointsType {
+	return EndpointsType{
+		AuthURI:    dropboxAuthURI,
+		APIURI:     dropboxAPIURI,
+		ContentURI: dropboxContentURI,
+	}
+}
+
+// WithEnvironment -endpoints overridden by the DROPBOX_*_URI environment variables, if set
+func (e EndpointsType) WithEnvironment() EndpointsType {
+	if v := os.Getenv(EnvAuthURI); v != "" {
+		e.AuthURI = v
+	}
+	if v := os.Getenv(EnvAPIURI); v != "" {
+		e.APIURI = v
+	}
+	if v := os.Getenv(EnvContentURI); v != "" {
+		e.ContentURI = v
+	}
+	return e
+}
+
+// SetEndpoints -point the client to different base URIs, empty values select the Dropbox defaults
+func (c *Client) SetEndpoints(e EndpointsType) {
+	defaults := DefaultEndpoints()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.authURI = endpointOrDefault(e.AuthURI, defaults.AuthURI)
+	c.apiURI = endpointOrDefault(e.APIURI, defaults.APIURI)
+	c.contentURI = endpointOrDefault(e.ContentURI, defaults.ContentURI)
+	c.accessToken = accessTokenType{} // token belongs to the previous server
+	c.credentials++
+}
+
+// Endpoints -base URIs currently in use
+func (c *Client) Endpoints() EndpointsType {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return EndpointsType{
+		AuthURI:    c.authURI,
+		APIURI:     c.apiURI,
+		ContentURI: c.contentURI,
+	}
+}
+
+// SetConnectionData -receive connection data from ui, invalidates the current access token
+func (c *Client) SetConnectionData(key AppAuthType, token string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.authkey = key
+	c.refreshToken = token
+	c.accessToken = accessTokenType{}
+	c.credentials++
+}
+
+// SetExistingFilesStrategy -skip, update or keep both versions of existing files (assets.OptXxx, compare hashes)
+func (c *Client) SetExistingFilesStrategy(strategy string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.existingFilesStrategy = strategy
+}
+
+// ExistingFilesStrategy -current strategy for existing files
+func (c *Client) ExistingFilesStrategy() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.existingFilesStrategy
+}
+
+// SetHashCache -cache for the content hashes of local files, nil disables caching
+func (c *Client) SetHashCache(cache *HashCacheType) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.hashCache = cache
+}
+
+// hashFile -content hash of a local file, from the hash cache if there is one
+func (c *Client) hashFile(ctx context.Context, osPath string) (string, error) {
+	c.mutex.Lock()
+	cache := c.hashCache
+	c.mutex.Unlock()
+	if cache != nil {
+		return cache.HashFile(ctx, osPath)
+	}
+	return HashFile(ctx, osPath)
+}
+
+// SetHTTPClient -replace the http client used for all requests
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.httpClient = httpClient
+}
+
+// apiURL -URL of an api endpoint
+func (c *Client) apiURL(endpoint string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.apiURI + endpoint
+}
+
+// contentURL -URL of a content endpoint
+func (c *Client) contentURL(endpoint string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.contentURI + endpoint
+}
+
+// do -send a request with the current http client
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	c.mutex.Lock()
+	httpClient := c.httpClient
+	c.mutex.Unlock()
+	return httpClient.Do(req)
+}
+
+// policies -current retry and poll policies
+func (c *Client) policies() (RetryPolicyType, PollPolicyType) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.retryPolicy, c.pollPolicy
+}
+
+// chunkSize -current upload chunk size
+func (c *Client) chunkSize() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.uploadChunkSize
 }
 
 // ConputeHash -compute file hash according to https://www.dropbox.com/developers/reference/content-hash
 func ConputeHash(payload []byte) string {
-	const chunksize int64 = 4194304
-	var sliceSize int64
-	var offset int64 = 0
-	var sha [32]byte
-	var slice, shabuffer []byte
-	var size = int64(len(payload))
-	for offset < size {
-		slice = nil
-		if size-offset >= chunksize {
-			sliceSize = chunksize
-		} else {
-			sliceSize = size - offset
-		}
-		slice = make([]byte, sliceSize)
-		copy(slice[:], payload[offset:])
-		offset += sliceSize
-		sha = sha256.Sum256(slice[:])
-		shabuffer = append(shabuffer, sha[:]...)
+	hasher := NewContentHasher()
+	_, _ = hasher.Write(payload)
+	return hasher.HexSum()
+}
+
+func endpointOrDefault(uri, def string) string {
+	uri = strings.TrimSuffix(strings.TrimSpace(uri), "/")
+	if uri == "" {
+		return def
 	}
-	sha = sha256.Sum256(shabuffer)
-	return fmt.Sprintf("%x", sha)
+	return uri
 }
 
 func CheckNameIsValid(name string) bool {
@@ -360,52 +794,184 @@ func CheckNameIsValid(name string) bool {
 	return true
 }
 
-// restCall -generic REST call
-func restCall[T any](para RESTParaType) (T, error) {
+// restCall -generic REST call with JSON result
+func restCall[T any](ctx context.Context, c *Client, para RESTParaType) (T, error) {
 	var result T
-	var dbxerror ErrorType
+	resp, err := restStream(ctx, c, para)
+	if err != nil {
+		return result, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(body, &result)
+	return result, err
+}
+
+// restStream -REST call returning the unread response of a successful call, the caller must close its body,
+// repeats the call according to the client's retry policy
+func restStream(ctx context.Context, c *Client, para RESTParaType) (*http.Response, error) {
+	var resp *http.Response
 	var err error
-	var errorString string
+	var status int
+	var header http.Header
+	var body []byte
+	var wait time.Duration
+	policy, _ := c.policies()
+	for attempt := 0; ; attempt++ {
+		status, header, body = 0, nil, nil
+		resp, err = doRequest(ctx, c, para)
+		if err == nil {
+			if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+				return resp, nil
+			}
+			status, header = resp.StatusCode, resp.Header
+			body, err = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+		}
+		wait = retryDelay(policy, attempt, para.ParaIdempotent, status, header, body, err)
+		if wait < 0 {
+			break
+		}
+		if e := sleepContext(ctx, wait); e != nil {
+			return nil, e
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, newDropboxError(status, para.ParaURL, body)
+}
+
+// doRequest -single http round trip
+func doRequest(ctx context.Context, c *Client, para RESTParaType) (*http.Response, error) {
 	var requestbody io.Reader = nil
+	var length int64
 	if len(para.ParaForm) > 0 {
 		requestbody = strings.NewReader(para.ParaForm.Encode()) // form fields
 	} else {
 		if len(para.ParaBody) > 0 {
-			requestbody = strings.NewReader(string(para.ParaBody)) // json
+			requestbody = bytes.NewReader(para.ParaBody) // json or file content
+			if para.ParaUpload {
+				requestbody = c.throttle(ctx, requestbody, true)
+			}
+			length = int64(len(para.ParaBody))
+			if para.ParaProgress != nil {
+				requestbody = &progressReader{reader: requestbody, progress: para.ParaProgress}
+			}
 		}
 	}
-	req, err := http.NewRequest(para.ParaMethod, para.ParaURL, requestbody)
+	req, err := http.NewRequestWithContext(ctx, para.ParaMethod, para.ParaURL, requestbody)
 	if err != nil {
-		return result, err
+		return nil, err
+	}
+	if length > 0 {
+		req.ContentLength = length
 	}
 	for _, h := range para.ParaHeader {
 		req.Header.Add(h.Key, h.Value)
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
+	if err == nil && para.ParaDownload {
+		resp.Body = throttledBody{c.throttle(ctx, resp.Body, false), resp.Body}
+	}
+	return resp, err
+}
+
+// progressReader -reports the number of bytes read so far
+type progressReader struct {
+	reader   io.Reader
+	read     int64
+	progress func(read int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.progress(p.read)
+	}
+	return n, err
+}
+
+// retryDelay -time to wait before the next attempt, negative if the call must not be repeated
+func retryDelay(policy RetryPolicyType, attempt int, idempotent bool, status int, header http.Header, body []byte,
+	err error) time.Duration {
+	var errorBody struct {
+		Error RateLimitErrorType `json:"error"`
+	}
+	if attempt >= policy.MaxRetries {
+		return -1
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return -1
+	}
+	switch {
+	case status == http.StatusTooManyRequests:
+		// rate limited calls have not been processed by Dropbox, always safe to repeat
+	case err != nil || status >= http.StatusInternalServerError:
+		if !idempotent {
+			return -1
+		}
+	default:
+		return -1
+	}
+	if seconds, e := strconv.ParseInt(header.Get(paraRetryAfter), 10, 64); e == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if status == http.StatusTooManyRequests && json.Unmarshal(body, &errorBody) == nil && errorBody.Error.RetryAfter > 0 {
+		return time.Duration(errorBody.Error.RetryAfter) * time.Second
+	}
+	return backoff(policy, attempt)
+}
+
+// sleepContext -wait for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff -exponential backoff with jitter, between half and full of BaseDelay * 2^attempt, capped by MaxDelay
+func backoff(policy RetryPolicyType, attempt int) time.Duration {
+	delay := policy.BaseDelay << attempt
+	if delay <= 0 || delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// headerJson -JSON for the Dropbox-API-Arg header, non-ASCII characters have to be escaped
+func headerJson[T any](v T) (string, error) {
+	var sb strings.Builder
+	j, err := anyToJson[T](v)
 	if err != nil {
-		return result, err
+		return "", err
 	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(resp.Body)
-	body, err := io.ReadAll(resp.Body)
-	if resp.StatusCode == http.StatusOK {
-		err = json.Unmarshal(body, &result)
-		return result, err
-	} else {
-		_ = json.Unmarshal(body, &dbxerror)
-		if dbxerror.ErrorSummary != "" {
-			errorString = dbxerror.ErrorSummary
-		} else {
-			if dbxerror.ErrorDescription != "" {
-				errorString = dbxerror.Error + " " + dbxerror.ErrorDescription
-			} else {
-				errorString = string(body)
-			}
+	for _, r := range j {
+		switch {
+		case r < utf8.RuneSelf:
+			sb.WriteRune(r)
+		case r > 0xffff:
+			r1, r2 := utf16.EncodeRune(r)
+			_, _ = fmt.Fprintf(&sb, "\\u%04x\\u%04x", r1, r2)
+		default:
+			_, _ = fmt.Fprintf(&sb, "\\u%04x", r)
 		}
-		return result, errors.New(errorString)
 	}
+	return sb.String(), nil
 }
 
 // anyToJson -generic JSON transformation
@@ -0,0 +1,133 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - polling of async jobs
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"Dropbox_REST_Client/assets"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// JobProgressFunc -called while an async job is in progress, with the number of checks so far and the time
+// since the job was started
+type JobProgressFunc func(polls int, elapsed time.Duration)
+
+// asyncJobResultType -answer of a batch call or its job check, tagged async_job_id, in_progress, complete or failed,
+// a pointer type whose nil value stands for a null answer
+type asyncJobResultType interface {
+	comparable
+	jobTag() string
+	jobId() string
+}
+
+// DefaultPollPolicy -poll policy of a new client
+func DefaultPollPolicy() PollPolicyType {
+	return PollPolicyType{
+		Interval:    defaultPollInterval,
+		MaxInterval: defaultMaxPollInterval,
+		Factor:      defaultPollFactor,
+	}
+}
+
+// SetPollPolicy -replace the poll policy of async jobs
+func (c *Client) SetPollPolicy(policy PollPolicyType) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.pollPolicy = policy
+}
+
+// next -interval after interval
+func (p PollPolicyType) next(interval time.Duration) time.Duration {
+	interval = time.Duration(float64(interval) * max(p.Factor, 1))
+	if p.MaxInterval > 0 {
+		interval = min(interval, p.MaxInterval)
+	}
+	return max(interval, time.Millisecond)
+}
+
+// batchJob -start a batch call, an answer that launched an async job is followed by checking the job at
+// checkEndpoint until it is complete
+func batchJob[T asyncJobResultType](ctx context.Context, c *Client, para RESTParaType, checkEndpoint string,
+	progress JobProgressFunc) (T, error) {
+	var zero T
+	result, err := restCall[T](ctx, c, para)
+	if err != nil {
+		return zero, err
+	}
+	if result == zero {
+		return zero, errors.New(assets.ErrorAsyncJobUnknownStatus)
+	}
+	if result.jobTag() == DbxAsyncJobId && result.jobId() != "" {
+		return pollJob[T](ctx, c, checkEndpoint, result.jobId(), progress)
+	}
+	return result, nil
+}
+
+// pollJob -check an async job at its check endpoint until it is complete, the intervals between the checks
+// grow as set by the poll policy, ctx bounds the total time, progress may be nil
+func pollJob[T asyncJobResultType](ctx context.Context, c *Client, endpoint string, id string,
+	progress JobProgressFunc) (T, error) {
+	var zero T
+	started := time.Now()
+	_, policy := c.policies()
+	interval := max(policy.Interval, time.Millisecond)
+	for polls := 1; ; polls++ {
+		token, err := c.requestAccessToken(ctx)
+		if err != nil {
+			return zero, jobError(err)
+		}
+		jbatchcheck, err := anyToJson[BatchCheckParaType](BatchCheckParaType{"", id})
+		if err != nil {
+			return zero, err
+		}
+		para := RESTParaType{
+			ParaURL:    c.apiURL(endpoint),
+			ParaMethod: http.MethodPost,
+			ParaHeader: []KeyValueType{
+				{paraAuthorization, string(valAuthBearer) + token},
+				{paraContentType, string(valContentTypeJson)},
+			},
+			ParaForm:       url.Values{},
+			ParaBody:       []byte(jbatchcheck),
+			ParaIdempotent: true,
+		}
+		result, err := restCall[T](ctx, c, para)
+		if err != nil {
+			return zero, jobError(err)
+		}
+		if result == zero {
+			return zero, errors.New(assets.ErrorAsyncJobUnknownStatus)
+		}
+		switch result.jobTag() {
+		case DbxInProgress:
+			if progress != nil {
+				progress(polls, time.Since(started))
+			}
+			if err = sleepContext(ctx, interval); err != nil {
+				return zero, jobError(err)
+			}
+			interval = policy.next(interval)
+		case DbxComplete:
+			return result, nil
+		case DbxFailed:
+			return zero, errors.New(assets.ErrorAsyncJobFailed)
+		default:
+			return zero, errors.New(assets.ErrorAsyncJobUnknownStatus)
+		}
+	}
+}
+
+// jobError -a job that outlasts the deadline of its context is reported as timed out, Dropbox may still finish it
+func jobError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w", assets.ErrorAsyncJobTimeOut, err)
+	}
+	return err
+}
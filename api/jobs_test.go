@@ -0,0 +1,190 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - batch calls and the polling of their async jobs
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/assets"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nullTransport -answers the calls of endpoint with a JSON null
+type nullTransport struct {
+	base     http.RoundTripper
+	endpoint string
+}
+
+func (t *nullTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && req.URL.Path == t.endpoint {
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(strings.NewReader("null"))
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+	}
+	return resp, err
+}
+
+func TestBatchJobs(t *testing.T) {
+	move := func(ctx context.Context, c *api.Client, progress api.JobProgressFunc) ([]string, error) {
+		result, err := c.BatchMoveFiles(ctx, []api.RelocationPathType{
+			{FromPath: "/a.txt", ToPath: "/folder/a.txt"},
+			{FromPath: "/b.txt", ToPath: "/folder/b.txt"},
+		}, progress)
+		return relocated(result), err
+	}
+	copyFiles := func(ctx context.Context, c *api.Client, progress api.JobProgressFunc) ([]string, error) {
+		result, err := c.BatchCopyFiles(ctx, []api.RelocationPathType{
+			{FromPath: "/a.txt", ToPath: "/folder/a.txt"},
+			{FromPath: "/b.txt", ToPath: "/folder/a.txt"},
+		}, progress)
+		return relocated(result), err
+	}
+	remove := func(ctx context.Context, c *api.Client, progress api.JobProgressFunc) ([]string, error) {
+		result, err := c.BatchDeleteFiles(ctx, []string{"/a.txt", "/b.txt"}, progress)
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for _, entry := range result.Entries {
+			paths = append(paths, entry.Metadata.PathDisplay)
+		}
+		return paths, nil
+	}
+	ensure := func(ctx context.Context, c *api.Client, progress api.JobProgressFunc) ([]string, error) {
+		folders, err := c.EnsureFolders(ctx, []string{"/folder", "/new", "/new/sub"}, progress)
+		var paths []string
+		for _, folder := range folders {
+			if folder != nil {
+				paths = append(paths, folder.PathDisplay)
+			}
+		}
+		return paths, err
+	}
+	tests := []struct {
+		name      string
+		call      func(ctx context.Context, c *api.Client, progress api.JobProgressFunc) ([]string, error)
+		check     string // check endpoint of the job
+		polls     int    // in_progress answers before the job is complete
+		wantPaths []string
+		wantGone  []string
+		wantLeft  []string
+	}{
+		{"move complete at once", move, "/2/files/move_batch/check_v2", 0,
+			[]string{"/folder/a.txt", "/folder/b.txt"}, []string{"/a.txt", "/b.txt"}, nil},
+		{"move polled", move, "/2/files/move_batch/check_v2", 3,
+			[]string{"/folder/a.txt", "/folder/b.txt"}, []string{"/a.txt", "/b.txt"}, nil},
+		{"copy polled with a conflict", copyFiles, "/2/files/copy_batch/check_v2", 2,
+			[]string{"/folder/a.txt", "/folder/a (1).txt"}, nil, []string{"/a.txt", "/b.txt"}},
+		{"delete polled", remove, "/2/files/delete_batch/check", 4,
+			[]string{"/a.txt", "/b.txt"}, []string{"/a.txt", "/b.txt"}, nil},
+		{"create folders polled", ensure, "/2/files/create_folder_batch/check", 2,
+			[]string{"/new", "/new/sub"}, nil, []string{"/folder", "/new/sub"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/a.txt", []byte("a"))
+			s.AddFile("/b.txt", []byte("b"))
+			s.AddFolder("/folder")
+			s.AsyncPolls = tt.polls
+			var reported []int
+			paths, err := tt.call(context.Background(), c, func(polls int, _ time.Duration) {
+				reported = append(reported, polls)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(paths, tt.wantPaths) {
+				t.Errorf("paths = %q, want %q", paths, tt.wantPaths)
+			}
+			if len(reported) != tt.polls || (tt.polls > 0 && reported[tt.polls-1] != tt.polls) {
+				t.Errorf("progress = %v, want %d calls counting the checks", reported, tt.polls)
+			}
+			if got := s.Calls(tt.check); got != tt.polls+1 {
+				t.Errorf("checks = %d, want %d", got, tt.polls+1)
+			}
+			for _, p := range tt.wantGone {
+				if s.Exists(p) {
+					t.Errorf("%s still exists", p)
+				}
+			}
+			for _, p := range tt.wantLeft {
+				if !s.Exists(p) {
+					t.Errorf("%s is gone", p)
+				}
+			}
+		})
+	}
+}
+
+func TestEnsureFoldersConflict(t *testing.T) {
+	s, c := newTestServer(t)
+	s.AddFile("/a.txt", []byte("a"))
+	folders, err := c.EnsureFolders(context.Background(), []string{"/a.txt", "/b"}, nil)
+	if !errors.Is(err, api.ErrConflict) {
+		t.Errorf("error = %v, want %v", err, api.ErrConflict)
+	}
+	if len(folders) != 2 || folders[0] != nil || folders[1] == nil || folders[1].Tag != api.DbxFolder {
+		t.Errorf("folders = %+v, want only /b created", folders)
+	}
+}
+
+func TestBatchJobTimeOut(t *testing.T) {
+	s, c := newTestServer(t)
+	s.AddFile("/a.txt", []byte("a"))
+	s.AsyncPolls = 1000
+	c.SetPollPolicy(api.PollPolicyType{Interval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond, Factor: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.BatchMoveFiles(ctx, []api.RelocationPathType{{FromPath: "/a.txt", ToPath: "/b.txt"}}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestBatchJobNullAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+	}{
+		{"batch call", "/2/files/move_batch_v2"},
+		{"job check", "/2/files/move_batch/check_v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/a.txt", []byte("a"))
+			c.SetHTTPClient(&http.Client{Transport: &nullTransport{base: s.Client().Transport, endpoint: tt.endpoint}})
+			_, err := c.BatchMoveFiles(context.Background(), []api.RelocationPathType{{FromPath: "/a.txt",
+				ToPath: "/b.txt"}}, nil)
+			if err == nil || err.Error() != assets.ErrorAsyncJobUnknownStatus {
+				t.Errorf("error = %v, want %s", err, assets.ErrorAsyncJobUnknownStatus)
+			}
+		})
+	}
+}
+
+// relocated -destination paths of the successful entries of a copy or move batch
+func relocated(result *api.RelocationBatchResultType) []string {
+	if result == nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range result.Entries {
+		if entry.Err() == nil {
+			paths = append(paths, entry.Success.PathDisplay)
+		}
+	}
+	return paths
+}
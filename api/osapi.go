@@ -6,6 +6,13 @@
 package api
 
 import (
+	"Dropbox_REST_Client/assets"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,10 +26,12 @@ type FileSysStructureType struct {
 	Size     int64
 }
 
+// ExplodeFolder -folder and its content, DbxPath is relative to the parent of folder,
+// for folders it is the full path, for files the path of the containing folder with trailing separator
 func ExplodeFolder(folder string) ([]*FileSysStructureType, error) {
 	var folderStructure []*FileSysStructureType
-	basepath := filepath.Base(folder) + string(os.PathSeparator)
-	prefixpath := strings.TrimSuffix(folder, basepath)
+	folder = filepath.Clean(folder)
+	prefixpath := filepath.Dir(folder)
 	err := filepath.Walk(folder,
 		func(path string, info os.FileInfo, err error) error {
 			var _path, _file string
@@ -34,8 +43,12 @@ func ExplodeFolder(folder string) ([]*FileSysStructureType, error) {
 				_path = _path + _file
 			}
 			// omit dot files and folders
+			if info.IsDir() && path != folder && _file[0] == '.' {
+				return filepath.SkipDir
+			}
 			if (_file == "") || (_file[0] != '.') {
-				shortpath := DbxPathSeparator + strings.TrimPrefix(_path, prefixpath)
+				shortpath := strings.TrimPrefix(strings.TrimPrefix(_path, prefixpath), string(os.PathSeparator))
+				shortpath = DbxPathSeparator + shortpath
 				shortpath = strings.ReplaceAll(shortpath, string(os.PathSeparator), DbxPathSeparator) // Windows
 				folderStructure = append(folderStructure,
 					&FileSysStructureType{
@@ -70,7 +83,7 @@ func ListLocalFileStructure(selection []string) ([]*FileSysStructureType, []*Fil
 					OSPath:   s,
 					DbxPath:  DbxPathSeparator,
 					FileName: file, //replaceInvalidChars(file),
-					IsFolder: true,
+					IsFolder: false,
 					Size:     stat.Size()},
 				)
 			}
@@ -100,3 +113,112 @@ func replaceInvalidChars(filename string) string {
 	}
 	return name
 }
+
+// ExtractZip -extract a zip archive into dir, entries pointing outside of dir are rejected, existing files with the
+// content of their entry are kept, the existing files strategy decides about the others
+func (c *Client) ExtractZip(ctx context.Context, zipPath string, dir string) error {
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer func(archive *zip.ReadCloser) {
+		_ = archive.Close()
+	}(archive)
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range archive.File {
+		target := filepath.Join(root, filepath.FromSlash(f.Name))
+		if target != root && !strings.HasPrefix(target, root+string(os.PathSeparator)) {
+			return errors.New(assets.ErrorInvalidZipEntry + f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err = os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		unchanged, err := c.unchangedZipFile(ctx, f, target)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			continue
+		}
+		target, skip, err := existingTarget(target, c.ExistingFilesStrategy())
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
+		if err = extractZipFile(f, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unchangedZipFile -check whether osPath is a file with the content of the archive entry, the sizes are compared
+// before the content hashes
+func (c *Client) unchangedZipFile(ctx context.Context, f *zip.File, osPath string) (bool, error) {
+	stat, err := os.Stat(osPath)
+	if err != nil || stat.IsDir() || uint64(stat.Size()) != f.UncompressedSize64 {
+		return false, nil // a missing or different target is left to the strategy
+	}
+	hash, err := c.hashFile(ctx, osPath)
+	if err != nil {
+		return false, err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer func(src io.ReadCloser) {
+		_ = src.Close()
+	}(src)
+	hasher := NewContentHasher()
+	if _, err = io.Copy(hasher, src); err != nil {
+		return false, err
+	}
+	return hasher.HexSum() == hash, nil
+}
+
+func extractZipFile(f *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func(src io.ReadCloser) {
+		_ = src.Close()
+	}(src)
+	dst, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err == nil && !f.Modified.IsZero() {
+		_ = os.Chtimes(target, f.Modified, f.Modified)
+	}
+	return err
+}
+
+// AvailableName -osPath, or the first free name of the form "name (n).ext"
+func AvailableName(osPath string) string {
+	ext := filepath.Ext(osPath)
+	base := strings.TrimSuffix(osPath, ext)
+	name := osPath
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
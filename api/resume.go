@@ -0,0 +1,111 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - upload sessions that can be resumed after an interruption
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"Dropbox_REST_Client/assets"
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// UploadResumeType -state of an interrupted upload session, persisted by the caller between runs
+type UploadResumeType struct {
+	SessionId string `json:"session_id"`
+	Offset    int64  `json:"offset"` // bytes committed to the session
+	Size      int64  `json:"size"`   // fingerprint of the local file
+	ModTime   int64  `json:"mtime"`
+	Inode     uint64 `json:"inode"`
+}
+
+// matches -check if the state belongs to the unchanged local file
+func (s *UploadResumeType) matches(stat os.FileInfo) bool {
+	return s != nil && s.SessionId != "" && s.Offset > 0 && s.Offset < stat.Size() && s.Size == stat.Size() &&
+		s.ModTime == stat.ModTime().UnixNano() && s.Inode == fileInode(stat)
+}
+
+// sessionLost -the server no longer accepts appending to the session at the offset given
+func sessionLost(err error) bool {
+	var dbxErr *DropboxError
+	return errors.As(err, &dbxErr) &&
+		(dbxErr.HasTag("not_found") || dbxErr.HasTag("incorrect_offset") || dbxErr.HasTag("closed"))
+}
+
+// uploadResumable -upload a local file larger than the upload chunk size through an upload session,
+// continues the session in resume if the file is unchanged, checkpoint receives the state after every chunk
+func (c *Client) uploadResumable(ctx context.Context, commit CommitInfoType, f *os.File, stat os.FileInfo,
+	resume *UploadResumeType, checkpoint func(UploadResumeType), progress ProgressFunc) (*FileItemType, error) {
+	ctx = withTransferLimiter(ctx) // the per transfer limit spans all chunks
+	size := stat.Size()
+	state := UploadResumeType{
+		Size:    size,
+		ModTime: stat.ModTime().UnixNano(),
+		Inode:   fileInode(stat),
+	}
+	hasher := NewContentHasher()
+	resumed := resume.matches(stat)
+	if resumed {
+		// the content hash covers the whole file, the part already sent is hashed again
+		if _, err := io.Copy(hasher, io.NewSectionReader(f, 0, resume.Offset)); err != nil {
+			return nil, err
+		}
+		state.SessionId, state.Offset = resume.SessionId, resume.Offset
+	}
+	chunkSize := c.chunkSize()
+	buffer := make([]byte, chunkSize)
+	for {
+		n, err := f.ReadAt(buffer[:min(size-state.Offset, chunkSize)], state.Offset)
+		if err != nil && !(errors.Is(err, io.EOF) && int64(n) == size-state.Offset) {
+			return nil, err
+		}
+		chunk := buffer[:n]
+		_, _ = hasher.Write(chunk)
+		cursor := UploadSessionCursorType{SessionId: state.SessionId, Offset: state.Offset}
+		switch {
+		case state.SessionId == "":
+			var start *UploadSessionStartType
+			start, err = contentCall[*UploadSessionStartType](ctx, c, endPointUploadSessionStart,
+				UploadSessionStartParaType{Close: false}, chunk, sendProgress(progress, 0, size))
+			if err == nil {
+				state.SessionId = start.SessionId
+			}
+		case state.Offset+int64(n) < size:
+			_, err = contentCall[*struct{}](ctx, c, endPointUploadSessionAppend,
+				UploadSessionAppendParaType{Cursor: cursor, Close: false}, chunk,
+				sendProgress(progress, cursor.Offset, size))
+		default:
+			// the last chunk goes with the commit
+			var metadata *FileItemType
+			metadata, err = contentCall[*FileItemType](ctx, c, endPointUploadSessionFinish,
+				UploadSessionFinishParaType{
+					Cursor:      cursor,
+					Commit:      commit,
+					ContentHash: hasher.HexSum(),
+				}, chunk, sendProgress(progress, cursor.Offset, size))
+			if err == nil {
+				if metadata.ContentHash != hasher.HexSum() {
+					return nil, errors.New(assets.ErrorContentHashMismatch)
+				}
+				return metadata, nil
+			}
+		}
+		if err != nil {
+			if resumed && sessionLost(err) {
+				// the session has expired or is out of step, the upload starts from scratch once
+				resumed = false
+				state.SessionId, state.Offset = "", 0
+				hasher.Reset()
+				continue
+			}
+			return nil, err
+		}
+		state.Offset += int64(n)
+		if checkpoint != nil {
+			checkpoint(state)
+		}
+	}
+}
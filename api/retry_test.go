@@ -0,0 +1,95 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - retries of rate limited and failed calls
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	const maxRetries = 3
+	getMetadata := func(ctx context.Context, c *api.Client) error {
+		_, err := c.GetMetadata(ctx, "/a.txt")
+		return err
+	}
+	move := func(ctx context.Context, c *api.Client) error {
+		_, err := c.MoveFiles(ctx, "/a.txt", "/b.txt")
+		return err
+	}
+	tests := []struct {
+		name       string
+		endpoint   string
+		call       func(ctx context.Context, c *api.Client) error
+		status     int
+		failures   int
+		retryAfter int // seconds
+		wantCalls  int
+		wantErr    error // nil: success
+		wantStatus int   // status of a DropboxError, if wantErr is not a sentinel
+		minElapsed time.Duration
+	}{
+		{"429 idempotent", "/2/files/get_metadata", getMetadata, http.StatusTooManyRequests, 2, 0, 3, nil, 0, 0},
+		{"429 not idempotent", "/2/files/move_v2", move, http.StatusTooManyRequests, 1, 0, 2, nil, 0, 0},
+		{"429 honours Retry-After", "/2/files/get_metadata", getMetadata, http.StatusTooManyRequests, 1, 1, 2, nil,
+			0, time.Second},
+		{"429 retries exhausted", "/2/files/get_metadata", getMetadata, http.StatusTooManyRequests, maxRetries + 1,
+			0, maxRetries + 1, api.ErrRateLimited, 0, 0},
+		{"500 idempotent", "/2/files/get_metadata", getMetadata, http.StatusInternalServerError, 2, 0, 3, nil, 0, 0},
+		{"503 idempotent", "/2/files/get_metadata", getMetadata, http.StatusServiceUnavailable, 1, 0, 2, nil, 0, 0},
+		{"500 not idempotent", "/2/files/move_v2", move, http.StatusInternalServerError, 1, 0, 1, nil,
+			http.StatusInternalServerError, 0},
+		{"400 never repeated", "/2/files/get_metadata", getMetadata, http.StatusBadRequest, 1, 0, 1, nil,
+			http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/a.txt", []byte("a"))
+			s.RetryAfter = tt.retryAfter
+			c.SetRetryPolicy(api.RetryPolicyType{MaxRetries: maxRetries, BaseDelay: time.Millisecond,
+				MaxDelay: 10 * time.Millisecond})
+			s.InjectFailure(tt.endpoint, tt.status, tt.failures)
+			started := time.Now()
+			err := tt.call(context.Background(), c)
+			elapsed := time.Since(started)
+			var dbxerr *api.DropboxError
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantStatus != 0:
+				if !errors.As(err, &dbxerr) || dbxerr.StatusCode != tt.wantStatus {
+					t.Errorf("error = %v, want status %d", err, tt.wantStatus)
+				}
+			case err != nil:
+				t.Errorf("error = %v, want success", err)
+			}
+			if got := s.Calls(tt.endpoint); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if elapsed < tt.minElapsed {
+				t.Errorf("elapsed = %v, want at least %v", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	s, c := newTestServer(t)
+	s.RetryAfter = 60
+	s.InjectFailure("/2/files/get_metadata", http.StatusTooManyRequests, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetMetadata(ctx, "/a.txt"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,80 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - file revisions
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+const (
+	DbxMaxRevisions  uint64 = 100 // largest limit accepted by list_revisions
+	revisionPrefix          = "rev:"
+	revisionModePath        = "path"
+)
+
+// RevisionPath -path argument addressing a revision of a file, e.g. to download it
+func RevisionPath(rev string) string {
+	return revisionPrefix + rev
+}
+
+// ListRevisions -the latest revisions of a file, newest first, a limit of 0 or above DbxMaxRevisions lists
+// DbxMaxRevisions
+func (c *Client) ListRevisions(ctx context.Context, path string, limit uint64) (*RevisionsType, error) {
+	token, err := c.requestAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 || limit > DbxMaxRevisions {
+		limit = DbxMaxRevisions
+	}
+	dbxpara := ListRevisionsParaType{Path: path, Mode: revisionModePath, Limit: limit}
+	jdbxpara, err := anyToJson[ListRevisionsParaType](dbxpara)
+	if err != nil {
+		return nil, err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endPointListRevisions),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraContentType, string(valContentTypeJson)},
+		},
+		ParaForm:       url.Values{},
+		ParaBody:       []byte(jdbxpara),
+		ParaIdempotent: true,
+	}
+	return restCall[*RevisionsType](ctx, c, para)
+}
+
+// RestoreFile -make a revision the current content of the file at path, returns the new revision
+func (c *Client) RestoreFile(ctx context.Context, path string, rev string) (*FileItemType, error) {
+	token, err := c.requestAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jdbxpara, err := anyToJson[RestoreParaType](RestoreParaType{Path: path, Rev: rev})
+	if err != nil {
+		return nil, err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endPointRestore),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraContentType, string(valContentTypeJson)},
+		},
+		ParaForm: url.Values{},
+		ParaBody: []byte(jdbxpara),
+	}
+	metadata, err := restCall[*FileItemType](ctx, c, para)
+	if err != nil {
+		return nil, err
+	}
+	metadata.Tag = DbxFile // restore answers with file metadata without a tag
+	return metadata, nil
+}
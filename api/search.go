@@ -0,0 +1,76 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - searching files and folders
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// File categories of SearchOptionsType
+const (
+	DbxCategoryImage        = "image"
+	DbxCategoryDocument     = "document"
+	DbxCategoryPdf          = "pdf"
+	DbxCategorySpreadsheet  = "spreadsheet"
+	DbxCategoryPresentation = "presentation"
+	DbxCategoryAudio        = "audio"
+	DbxCategoryVideo        = "video"
+	DbxCategoryFolder       = "folder"
+	DbxCategoryPaper        = "paper"
+	DbxCategoryOthers       = "others"
+)
+
+const DbxMaxSearchResults uint64 = 1000 // largest page of search results
+
+// Search -find files and folders by name, or by name and content unless options.FilenameOnly, pages are
+// read until limit matches are found, limit 0 reads all
+func (c *Client) Search(ctx context.Context, query string, options SearchOptionsType,
+	limit int) ([]*FileItemType, error) {
+	var matches []*FileItemType
+	jdbxpara, err := anyToJson[SearchParaType](SearchParaType{Query: query, Options: options})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := endPointSearch
+	for {
+		token, err := c.requestAccessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var para = RESTParaType{
+			ParaURL:    c.apiURL(endpoint),
+			ParaMethod: http.MethodPost,
+			ParaHeader: []KeyValueType{
+				{paraAuthorization, string(valAuthBearer) + token},
+				{paraContentType, string(valContentTypeJson)},
+			},
+			ParaForm:       url.Values{},
+			ParaBody:       []byte(jdbxpara),
+			ParaIdempotent: true,
+		}
+		result, err := restCall[SearchResultType](ctx, c, para)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range result.Matches {
+			metadata := match.Metadata.Metadata
+			matches = append(matches, &metadata)
+		}
+		if !result.HasMore || (limit > 0 && len(matches) >= limit) {
+			break
+		}
+		if jdbxpara, err = anyToJson[ListContinueType](ListContinueType{result.Cursor}); err != nil {
+			return nil, err
+		}
+		endpoint = endPointSearchContinue
+	}
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
@@ -0,0 +1,145 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - bandwidth throttling of uploads and downloads
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	throttleChunk = 32 * 1024              // largest read accounted at once while throttled
+	throttleBurst = 250 * time.Millisecond // unused bandwidth that may be caught up after a pause
+)
+
+// BandwidthType -rate limits in bytes per second, 0 is unlimited, Upload and Download are shared by all
+// transfers, PerTransfer limits every single request stream, if Scheduled the limits apply only between
+// From and To (minutes since midnight, local time), From > To spans midnight
+type BandwidthType struct {
+	Upload      int64 `json:"upload"`
+	Download    int64 `json:"download"`
+	PerTransfer int64 `json:"per_transfer"`
+	Scheduled   bool  `json:"scheduled"`
+	From        int   `json:"from"`
+	To          int   `json:"to"`
+}
+
+// limits -the limits in effect at time t, nil if there are none
+func (b BandwidthType) limits(t time.Time) *BandwidthType {
+	if b.Upload <= 0 && b.Download <= 0 && b.PerTransfer <= 0 {
+		return nil
+	}
+	if b.Scheduled {
+		now := t.Hour()*60 + t.Minute()
+		inside := b.From <= now && now < b.To
+		if b.From > b.To {
+			inside = now >= b.From || now < b.To
+		}
+		if !inside {
+			return nil
+		}
+	}
+	return &b
+}
+
+// SetBandwidth -change the rate limits, running transfers adapt at once
+func (c *Client) SetBandwidth(bandwidth BandwidthType) {
+	c.bandwidthMutex.Lock()
+	c.bandwidth = bandwidth
+	c.bandwidthMutex.Unlock()
+}
+
+// Bandwidth -the configured rate limits
+func (c *Client) Bandwidth() BandwidthType {
+	c.bandwidthMutex.Lock()
+	defer c.bandwidthMutex.Unlock()
+	return c.bandwidth
+}
+
+// limiterType -paces a stream of bytes to a rate that may change between two calls
+type limiterType struct {
+	mutex sync.Mutex
+	next  time.Time // when the bytes accounted so far have been sent at the rate
+}
+
+// wait -account n bytes and sleep until they may be sent at rate bytes per second, rate <= 0 is unlimited
+func (l *limiterType) wait(ctx context.Context, n int, rate int64) error {
+	if rate <= 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	now := time.Now()
+	if earliest := now.Add(-throttleBurst); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mutex.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, delay)
+}
+
+// transferLimiterKey -context key of the limiter shared by the requests of a transfer
+type transferLimiterKey struct{}
+
+// withTransferLimiter -ctx carrying a per transfer limiter for the chunks or Range requests of one transfer,
+// ctx is returned unchanged if it carries one already
+func withTransferLimiter(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(transferLimiterKey{}).(*limiterType); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, transferLimiterKey{}, &limiterType{})
+}
+
+// throttledReader -reads at the rate of the shared limiter of its direction and the per transfer limit
+type throttledReader struct {
+	ctx      context.Context
+	client   *Client
+	reader   io.Reader
+	upload   bool
+	transfer *limiterType
+}
+
+// throttle -wrap r in a throttled reader of the given direction, a request outside of a transfer started by
+// withTransferLimiter is limited on its own
+func (c *Client) throttle(ctx context.Context, r io.Reader, upload bool) io.Reader {
+	transfer, ok := ctx.Value(transferLimiterKey{}).(*limiterType)
+	if !ok {
+		transfer = &limiterType{}
+	}
+	return &throttledReader{ctx: ctx, client: c, reader: r, upload: upload, transfer: transfer}
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	limits := t.client.Bandwidth().limits(time.Now())
+	if limits == nil {
+		return t.reader.Read(b)
+	}
+	shared, rate := &t.client.downloadLimiter, limits.Download
+	if t.upload {
+		shared, rate = &t.client.uploadLimiter, limits.Upload
+	}
+	n, err := t.reader.Read(b[:min(len(b), throttleChunk)])
+	if n > 0 {
+		if e := shared.wait(t.ctx, n, rate); e != nil {
+			return n, e
+		}
+		if e := t.transfer.wait(t.ctx, n, limits.PerTransfer); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+// throttledBody -throttled response body
+type throttledBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,67 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - bandwidth throttling
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestThrottledDownload(t *testing.T) {
+	const size = 512 * 1024
+	tests := []struct {
+		name       string
+		bandwidth  api.BandwidthType
+		minElapsed time.Duration
+	}{
+		{"unlimited", api.BandwidthType{}, 0},
+		{"download limit", api.BandwidthType{Download: 1024 * 1024}, 200 * time.Millisecond},
+		{"per transfer limit", api.BandwidthType{PerTransfer: 1024 * 1024}, 200 * time.Millisecond},
+		{"upload limit only", api.BandwidthType{Upload: 1024}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.AddFile("/file.bin", testContent(size))
+			c.SetBandwidth(tt.bandwidth)
+			started := time.Now()
+			if _, err := c.DownloadToFile(context.Background(), "/file.bin", filepath.Join(t.TempDir(), "file.bin"),
+				nil); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(started); elapsed < tt.minElapsed {
+				t.Errorf("elapsed = %v, want at least %v", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestCallsNotThrottled(t *testing.T) {
+	s, c := newTestServer(t)
+	s.AddFile("/file.bin", testContent(4*1024*1024))
+	c.SetBandwidth(api.BandwidthType{Download: 64 * 1024}) // a chunk of the download waits for half a second
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = c.DownloadToFile(ctx, "/file.bin", filepath.Join(t.TempDir(), "file.bin"), nil)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	time.Sleep(100 * time.Millisecond) // the download has used up the limit
+	started := time.Now()
+	if _, err := c.GetMetadata(context.Background(), "/file.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Errorf("metadata call took %v while a download was throttled", elapsed)
+	}
+}
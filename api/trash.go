@@ -0,0 +1,71 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - deleted files and folders
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+const DbxAccountBusiness = "business" // account type of team members
+
+// ListDeleted -deleted files and folders below path (all levels), the entries carry the tag DbxDeleted and
+// no id, revision or size
+func (c *Client) ListDeleted(ctx context.Context, path string, limit uint32) ([]*FileItemType, error) {
+	var deleted []*FileItemType
+	entries, err := c.listFolders(ctx, path, true, true, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Tag == DbxDeleted {
+			deleted = append(deleted, e)
+		}
+	}
+	return deleted, nil
+}
+
+// RestoreDeleted -restore a deleted file to the last revision it had before it was deleted
+func (c *Client) RestoreDeleted(ctx context.Context, path string) (*FileItemType, error) {
+	revisions, err := c.ListRevisions(ctx, path, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions.Entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return c.RestoreFile(ctx, path, revisions.Entries[0].Rev)
+}
+
+// CanDeletePermanently -Dropbox offers permanent deletion to team accounts only
+func CanDeletePermanently(userinfo *UserInfoType) bool {
+	return userinfo != nil && userinfo.AccountType.Tag == DbxAccountBusiness
+}
+
+// PermanentlyDelete -delete a file or folder, live or deleted, beyond recovery
+func (c *Client) PermanentlyDelete(ctx context.Context, path string) error {
+	token, err := c.requestAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	jdbxpara, err := anyToJson[FilePathParaType](FilePathParaType{path})
+	if err != nil {
+		return err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.apiURL(endPointPermanentlyDelete),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraContentType, string(valContentTypeJson)},
+		},
+		ParaForm: url.Values{},
+		ParaBody: []byte(jdbxpara),
+	}
+	_, err = restCall[*struct{}](ctx, c, para)
+	return err
+}
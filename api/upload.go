@@ -0,0 +1,165 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API - streaming uploads, upload sessions for large files
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api
+
+import (
+	"Dropbox_REST_Client/assets"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// SetUploadChunkSize -size of the chunks sent by upload sessions, rounded down to a multiple of 4 MiB,
+// files up to this size are uploaded in a single request
+func (c *Client) SetUploadChunkSize(size int64) {
+	size -= size % DbxUploadChunkUnit
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.uploadChunkSize = min(max(size, DbxUploadChunkUnit), DbxMaxUploadChunk)
+}
+
+// UploadLocalFile -upload a local file, see UploadReader
+func (c *Client) UploadLocalFile(ctx context.Context, osPath string, path string, progress ProgressFunc) (*FileItemType,
+	error) {
+	f, err := os.Open(osPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return c.UploadReader(ctx, path, f, stat.Size(), progress)
+}
+
+// UploadReader -upload size bytes read from r, files larger than the upload chunk size go through an upload session,
+// memory use is bounded by the chunk size, the content hash is verified against the returned metadata
+func (c *Client) UploadReader(ctx context.Context, path string, r io.Reader, size int64,
+	progress ProgressFunc) (*FileItemType, error) {
+	return c.uploadCommit(ctx, CommitInfoType{Mode: WriteModeType{Tag: OverWrite}, Path: path}, r, size, progress)
+}
+
+// uploadCommit -UploadReader with explicit write mode and conflict handling
+func (c *Client) uploadCommit(ctx context.Context, commit CommitInfoType, r io.Reader, size int64,
+	progress ProgressFunc) (*FileItemType, error) {
+	var err error
+	var metadata *FileItemType
+	var start *UploadSessionStartType
+	var chunk []byte
+	ctx = withTransferLimiter(ctx) // the per transfer limit spans all chunks
+	hasher := NewContentHasher()
+	chunkSize := c.chunkSize()
+	buffer := make([]byte, min(size, chunkSize))
+	// next chunk of the file, fails if r ends before size bytes have been read
+	readChunk := func(offset int64) ([]byte, error) {
+		n, err := io.ReadFull(r, buffer[:min(size-offset, int64(len(buffer)))])
+		if err != nil {
+			return nil, err
+		}
+		_, _ = hasher.Write(buffer[:n])
+		return buffer[:n], nil
+	}
+	if chunk, err = readChunk(0); err != nil {
+		return nil, err
+	}
+	if size <= chunkSize {
+		metadata, err = c.uploadSingle(ctx, commit, chunk, hasher.HexSum(), sendProgress(progress, 0, size))
+	} else {
+		start, err = contentCall[*UploadSessionStartType](ctx, c, endPointUploadSessionStart,
+			UploadSessionStartParaType{Close: false}, chunk, sendProgress(progress, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		cursor := UploadSessionCursorType{SessionId: start.SessionId, Offset: int64(len(chunk))}
+		for {
+			if chunk, err = readChunk(cursor.Offset); err != nil {
+				return nil, err
+			}
+			if cursor.Offset+int64(len(chunk)) == size {
+				break // the last chunk goes with the commit
+			}
+			_, err = contentCall[*struct{}](ctx, c, endPointUploadSessionAppend,
+				UploadSessionAppendParaType{Cursor: cursor, Close: false}, chunk,
+				sendProgress(progress, cursor.Offset, size))
+			if err != nil {
+				return nil, err
+			}
+			cursor.Offset += int64(len(chunk))
+		}
+		metadata, err = contentCall[*FileItemType](ctx, c, endPointUploadSessionFinish,
+			UploadSessionFinishParaType{
+				Cursor:      cursor,
+				Commit:      commit,
+				ContentHash: hasher.HexSum(),
+			}, chunk, sendProgress(progress, cursor.Offset, size))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if metadata.ContentHash != hasher.HexSum() {
+		return nil, errors.New(assets.ErrorContentHashMismatch)
+	}
+	return metadata, nil
+}
+
+// uploadSingle -upload a file in a single request
+func (c *Client) uploadSingle(ctx context.Context, commit CommitInfoType, payload []byte, hash string,
+	progress func(sent int64)) (*FileItemType, error) {
+	opts := UploadFileParaType{
+		AutoRename:     commit.AutoRename,
+		Path:           commit.Path,
+		Mode:           commit.Mode,
+		ClientModified: commit.ClientModified,
+		Mute:           commit.Mute,
+		StrictConflict: commit.StrictConflict,
+		ContentHash:    hash,
+	}
+	return contentCall[*FileItemType](ctx, c, endPointFilesUpload, opts, payload, progress)
+}
+
+// sendProgress -translate the progress of a single request into the progress of the whole transfer
+func sendProgress(progress ProgressFunc, offset, total int64) func(sent int64) {
+	if progress == nil {
+		return nil
+	}
+	return func(sent int64) {
+		progress(offset+sent, total)
+	}
+}
+
+// contentCall -generic call to the content endpoint, argument in the Dropbox-API-Arg header, payload as body
+func contentCall[T any](ctx context.Context, c *Client, endpoint string, arg any, payload []byte,
+	progress func(sent int64)) (T, error) {
+	var result T
+	token, err := c.requestAccessToken(ctx)
+	if err != nil {
+		return result, err
+	}
+	jarg, err := headerJson(arg)
+	if err != nil {
+		return result, err
+	}
+	var para = RESTParaType{
+		ParaURL:    c.contentURL(endpoint),
+		ParaMethod: http.MethodPost,
+		ParaHeader: []KeyValueType{
+			{paraAuthorization, string(valAuthBearer) + token},
+			{paraContentType, string(valContentTypeOctetStream)},
+			{paraDbxAPIArg, jarg},
+		},
+		ParaForm:     url.Values{},
+		ParaBody:     payload,
+		ParaProgress: progress,
+		ParaUpload:   true,
+	}
+	return restCall[T](ctx, c, para)
+}
@@ -0,0 +1,191 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// REST API tests - uploads, upload sessions and their resumption
+// ---------------------------------------------------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	endpointUpload        = "/2/files/upload"
+	endpointSessionStart  = "/2/files/upload_session/start"
+	endpointSessionAppend = "/2/files/upload_session/append_v2"
+	endpointSessionFinish = "/2/files/upload_session/finish"
+)
+
+// corruptingTransport -flips the first byte of the request bodies sent to endpoint
+type corruptingTransport struct {
+	base     http.RoundTripper
+	endpoint string
+}
+
+func (t *corruptingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == t.endpoint && req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > 0 {
+			body[0] ^= 0xff
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return t.base.RoundTrip(req)
+}
+
+func TestUploadReader(t *testing.T) {
+	chunk := int(api.DbxUploadChunkUnit)
+	tests := []struct {
+		name       string
+		size       int
+		wantUpload int
+		wantStart  int
+		wantAppend int
+		wantFinish int
+	}{
+		{"empty", 0, 1, 0, 0, 0},
+		{"small", 10, 1, 0, 0, 0},
+		{"one chunk", chunk, 1, 0, 0, 0},
+		{"one chunk and a byte", chunk + 1, 0, 1, 0, 1},
+		{"two and a half chunks", chunk*5/2 + 3, 0, 1, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			c.SetUploadChunkSize(api.DbxUploadChunkUnit)
+			content := testContent(tt.size)
+			var reported int64
+			metadata, err := c.UploadReader(context.Background(), "/up/file.bin", bytes.NewReader(content),
+				int64(len(content)), func(transferred, total int64) {
+					if total != int64(len(content)) {
+						t.Errorf("progress total = %d, want %d", total, len(content))
+					}
+					reported = transferred
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := s.Content("/up/file.bin"); !bytes.Equal(got, content) {
+				t.Errorf("uploaded %d bytes, want %d", len(got), len(content))
+			}
+			if want := api.ConputeHash(content); metadata.ContentHash != want {
+				t.Errorf("ContentHash = %s, want %s", metadata.ContentHash, want)
+			}
+			if len(content) > 0 && reported != int64(len(content)) {
+				t.Errorf("progress = %d, want %d", reported, len(content))
+			}
+			for endpoint, want := range map[string]int{endpointUpload: tt.wantUpload,
+				endpointSessionStart: tt.wantStart, endpointSessionAppend: tt.wantAppend,
+				endpointSessionFinish: tt.wantFinish} {
+				if got := s.Calls(endpoint); got != want {
+					t.Errorf("calls of %s = %d, want %d", endpoint, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadHashMismatch(t *testing.T) {
+	chunk := int(api.DbxUploadChunkUnit)
+	tests := []struct {
+		name     string
+		size     int
+		endpoint string // corrupted on the way
+	}{
+		{"single upload", 100, endpointUpload},
+		{"session start", chunk + 1, endpointSessionStart},
+		{"session append", chunk*2 + 1, endpointSessionAppend},
+		{"session finish", chunk + 1, endpointSessionFinish},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			c.SetUploadChunkSize(api.DbxUploadChunkUnit)
+			c.SetHTTPClient(&http.Client{Transport: &corruptingTransport{base: s.Client().Transport,
+				endpoint: tt.endpoint}})
+			content := testContent(tt.size)
+			_, err := c.UploadReader(context.Background(), "/file.bin", bytes.NewReader(content), int64(len(content)),
+				nil)
+			var dbxerr *api.DropboxError
+			if !errors.As(err, &dbxerr) || !dbxerr.HasTag("content_hash_mismatch") {
+				t.Errorf("error = %v, want content_hash_mismatch", err)
+			}
+			if s.Exists("/file.bin") {
+				t.Error("corrupted upload has been committed")
+			}
+		})
+	}
+}
+
+func TestUploadResumable(t *testing.T) {
+	chunk := int(api.DbxUploadChunkUnit)
+	tests := []struct {
+		name      string
+		change    func(osPath string) error // applied to the local file before resuming
+		wantStart int
+	}{
+		{"unchanged file continues the session", nil, 1},
+		{"changed file starts a new session", func(osPath string) error {
+			later := time.Now().Add(time.Hour)
+			return os.Chtimes(osPath, later, later)
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			c.SetUploadChunkSize(api.DbxUploadChunkUnit)
+			content := testContent(chunk*5/2 + 3)
+			osPath := filepath.Join(t.TempDir(), "file.bin")
+			if err := os.WriteFile(osPath, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			var resume *api.UploadResumeType
+			checkpoint := func(state api.UploadResumeType) { resume = &state }
+			// appending is not repeated, the first run stops after the first chunk
+			s.InjectFailure(endpointSessionAppend, http.StatusInternalServerError, 1)
+			ctx := context.Background()
+			if _, _, err := c.UploadLocalFileResumable(ctx, osPath, "/file.bin", nil, checkpoint, nil); err == nil {
+				t.Fatal("interrupted upload succeeded")
+			}
+			if resume == nil || resume.Offset != int64(chunk) || resume.SessionId == "" {
+				t.Fatalf("checkpoint = %+v, want the first chunk committed", resume)
+			}
+			if tt.change != nil {
+				if err := tt.change(osPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var sent int64
+			metadata, skipped, err := c.UploadLocalFileResumable(ctx, osPath, "/file.bin", resume, checkpoint,
+				func(transferred, _ int64) { sent = max(sent, transferred) })
+			if err != nil || skipped {
+				t.Fatalf("resumed upload: skipped %v, error %v", skipped, err)
+			}
+			if got, _ := s.Content("/file.bin"); !bytes.Equal(got, content) {
+				t.Errorf("uploaded %d bytes, want %d", len(got), len(content))
+			}
+			if want := api.ConputeHash(content); metadata.ContentHash != want {
+				t.Errorf("ContentHash = %s, want %s", metadata.ContentHash, want)
+			}
+			if got := s.Calls(endpointSessionStart); got != tt.wantStart {
+				t.Errorf("sessions started = %d, want %d", got, tt.wantStart)
+			}
+			if sent != int64(len(content)) {
+				t.Errorf("progress = %d, want %d", sent, len(content))
+			}
+		})
+	}
+}
@@ -16,6 +16,12 @@ const (
 	CapAuthorizationCode = "Authorization Code"
 	CapError             = "Error"
 	CapAboutUser         = "About User"
+	CapUploadLimit       = "Upload Limit (KiB/s)"
+	CapDownloadLimit     = "Download Limit (KiB/s)"
+	CapTransferLimit     = "Limit per Transfer (KiB/s)"
+	CapLimitFrom         = "Limit only from (hh:mm)"
+	CapLimitUntil        = "until (hh:mm)"
+	CapWorkers           = "Concurrent Transfers"
 )
 
 const (
@@ -46,11 +52,82 @@ const (
 	CapDownload       = "Download"
 	CapCreateFolder   = "Create Folder"
 	CapClearSelection = "Clear Selection"
+	CapCancel         = "Cancel"
 	CapOptions        = "Existing Files"
+	CapDownloadFolder = "Download Folder"
+	CapPruneHashCache = "Prune Hash Cache"
+	CapTransfers      = "Transfers"
+	CapPause          = "Pause"
+	CapResume         = "Resume"
+	CapPauseAll       = "Pause All"
+	CapResumeAll      = "Resume All"
+	CapCancelAll      = "Cancel All"
+	CapFinish         = "Finish"
+	CapSuspend        = "Suspend"
+	CapDownloadZip    = "Download as ZIP"
+	CapDownloadUnzip  = "Download and Extract"
+	CapVersionHistory = "Version History"
+	CapRestore        = "Restore"
 )
 
+// Trash view
 const (
-	TxtDropboxError = "Dropbox error occurred."
+	CapTrash                      = "Trash"
+	CapFiles                      = "Files"
+	CapDeletePermanently          = "Delete Permanently"
+	TxtPermanentDelete            = "Delete %d entries permanently?"
+	TxtPermanentDeleteDetail      = "Entries deleted permanently cannot be restored."
+	TxtPermanentDeleteUnavailable = "Dropbox offers permanent deletion to team accounts only."
+	ErrorPermanentDelete          = "Error deleting files permanently."
+)
+
+// Search
+const (
+	CapSearch            = "Search"
+	CapNamesOnly         = "Names only"
+	CapRevealInFolders   = "Reveal in Folders"
+	CapMoveTo            = "Move to Folder..."
+	CapDestinationFolder = "Destination Folder"
+	TxtSearchHint        = "Search, ext:pdf in:/Folder"
+	TxtSearchMatches     = "%d matches"
+	OptAllCategories     = "All Kinds"
+	OptImages            = "Images"
+	OptDocuments         = "Documents"
+	OptPdfs              = "PDFs"
+	OptSpreadsheets      = "Spreadsheets"
+	OptPresentations     = "Presentations"
+	OptAudio             = "Audio"
+	OptVideos            = "Videos"
+	OptFolders           = "Folders"
+	ErrorSearching       = "Error searching Dropbox."
+	ErrorNoItemSelected  = "Please select one file or folder."
+)
+
+const (
+	TxtDropboxError         = "Dropbox error occurred."
+	TxtAuthorizationExpired = "The Dropbox authorization is no longer valid. Please authorize the app again."
+	TxtItemNotFound         = "The file or folder no longer exists in Dropbox. The view will be refreshed."
+	TxtItemConflict         = "A file or folder with this name already exists."
+	TxtInsufficientSpace    = "There is not enough space left in your Dropbox."
+	TxtRateLimited          = "Dropbox is limiting the number of requests. Please try again later."
+	TxtFolderDownload       = "How should the selected folders be downloaded?"
+	TxtFolderDownloadDetail = "A ZIP archive is saved as is, or it is extracted into the target folder."
+	TxtTransferIdle         = "No transfers running."
+	TxtTransferProgress     = "%d of %d files, %s of %s"
+	TxtTransferFailed       = ", %d failed"
+	TxtTransferRate         = ", %s/s, %v remaining"
+	TxtJobProgress          = "Waiting for Dropbox to finish the job (%s)"
+	TxtRevision             = "%s   %s   %s"
+	TxtCurrentRevision      = "   (current)"
+	TxtQuitWithTransfers    = "Transfers are still running."
+	TxtQuitTransfersDetail  = "Finish them before quitting, or suspend them and continue at the next start."
+	TxtStateQueued          = "queued"
+	TxtStateRunning         = "running"
+	TxtStatePaused          = "paused"
+	TxtStateSuspended       = "suspended"
+	TxtStateDone            = "done"
+	TxtStateFailed          = "failed"
+	TxtStateCancelled       = "cancelled"
 )
 
 const (
@@ -59,11 +136,28 @@ const (
 	ErrorAsyncJobUnknownStatus = "async job returned unknown status"
 	ErrorTooManySelections     = "Please select only one folder as parent."
 	ErrorNoFolderSelected      = "No folder selected."
+	ErrorNoFileSelected        = "No file selected."
+	ErrorDownloading           = "Error downloading files."
+	ErrorUploading             = "Error uploading files."
+	ErrorCopying               = "Error copying files."
+	ErrorMoving                = "Error moving files."
+	ErrorRestoring             = "Error restoring files."
+	ErrorListingRevisions      = "Error listing the revisions of the file."
+	ErrorWritingHashCache      = "Error writing the hash cache."
+	ErrorTransfers             = "Some transfers failed."
 	ErrorCreatingFolder        = "Error creating folder."
 	ErrorReadError             = "Read error."
+	ErrorNotFound              = "not found"
+	ErrorConflict              = "conflict"
+	ErrorInsufficientSpace     = "insufficient space"
+	ErrorRateLimited           = "rate limited"
+	ErrorInvalidAccessToken    = "invalid access token"
+	ErrorContentHashMismatch   = "content hash of the transferred file does not match"
+	ErrorInvalidZipEntry       = "zip entry points outside of the target folder: "
 )
 
 const (
-	OptUpdate = "Update"
-	OptSkip   = "Skip"
+	OptUpdate   = "Update"
+	OptSkip     = "Skip"
+	OptKeepBoth = "Keep both"
 )
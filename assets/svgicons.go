@@ -30,3 +30,12 @@ var IconDownload string
 
 //go:embed clear.svg
 var IconClear string
+
+//go:embed cancel.svg
+var IconCancel string
+
+//go:embed trash.svg
+var IconTrash string
+
+//go:embed restore.svg
+var IconRestore string
@@ -9,11 +9,15 @@ package dialogs
 import (
 	"Dropbox_REST_Client/api"
 	"Dropbox_REST_Client/assets"
+	"context"
 	"errors"
+	"fmt"
 	"github.com/richardwilkes/toolbox/errs"
 	"github.com/richardwilkes/unison"
 	"github.com/richardwilkes/unison/enums/align"
+	"github.com/richardwilkes/unison/enums/behavior"
 	"strings"
+	"time"
 )
 
 const (
@@ -21,6 +25,13 @@ const (
 	imageHeight float32 = 150
 )
 
+const pictureTimeout = 15 * time.Second
+
+const (
+	revisionsWidth  float32 = 700
+	revisionsHeight float32 = 250
+)
+
 func AboutDialog(item unison.MenuItem) {
 	dialog, err := unison.NewDialog(nil, nil, newAboutPanel(),
 		[]*unison.DialogButtonInfo{unison.NewOKButtonInfo()},
@@ -137,13 +148,15 @@ func DialogToDisplaySystemError(primary string, detail error) {
 	}
 }
 
-func AboutUserDialog(userinfo *api.UserInfoType) {
+func AboutUserDialog(client *api.Client, userinfo *api.UserInfoType) {
 	var image *unison.Image
 	var frame unison.Rect
 	var imagePanel *unison.Panel
 	var cols int = 1
 	if userinfo.ProfilePhotoUrl != "" {
-		rawdata, _ := api.CurrentUserGetPicture(userinfo.ProfilePhotoUrl)
+		ctx, cancel := context.WithTimeout(context.Background(), pictureTimeout)
+		rawdata, _ := client.CurrentUserGetPicture(ctx, userinfo.ProfilePhotoUrl)
+		cancel()
 		if rawdata != nil {
 			image, _ = unison.NewImageFromBytes(rawdata, 1)
 		}
@@ -341,3 +354,184 @@ func DialogToQueryFolderName() string {
 	}
 	return inpName.Text()
 }
+
+// Folder download modes, returned by DialogToQueryFolderDownload
+const (
+	FolderDownloadCancel = unison.ModalResponseCancel
+	FolderDownloadZip    = unison.ModalResponseUserBase + iota
+	FolderDownloadUnzip
+)
+
+// DialogToQueryFolderDownload -ask whether folders are downloaded as ZIP archive or extracted locally
+func DialogToQueryFolderDownload() int {
+	panel := unison.NewMessagePanel(assets.TxtFolderDownload, assets.TxtFolderDownloadDetail)
+	buttons := []*unison.DialogButtonInfo{
+		unison.NewCancelButtonInfo(),
+		{Title: assets.CapDownloadZip, ResponseCode: FolderDownloadZip},
+		{Title: assets.CapDownloadUnzip, ResponseCode: FolderDownloadUnzip, KeyCodes: []unison.KeyCode{unison.KeyReturn,
+			unison.KeyNumPadEnter}},
+	}
+	dialog, err := unison.NewDialog(unison.DefaultDialogTheme.QuestionIcon, unison.DefaultDialogTheme.QuestionIconInk,
+		panel, buttons, unison.NotResizableWindowOption())
+	if err != nil {
+		errs.Log(err)
+		return FolderDownloadCancel
+	}
+	dialog.Window().SetTitle(assets.CapDownloadFolder)
+	return dialog.RunModal()
+}
+
+// Answers of DialogToQueryQuitWithTransfers
+const (
+	QuitCancel = unison.ModalResponseCancel
+	QuitFinish = unison.ModalResponseUserBase + iota
+	QuitSuspend
+)
+
+// DialogToQueryQuitWithTransfers -ask whether running transfers are finished or suspended before quitting
+func DialogToQueryQuitWithTransfers() int {
+	panel := unison.NewMessagePanel(assets.TxtQuitWithTransfers, assets.TxtQuitTransfersDetail)
+	buttons := []*unison.DialogButtonInfo{
+		unison.NewCancelButtonInfo(),
+		{Title: assets.CapFinish, ResponseCode: QuitFinish},
+		{Title: assets.CapSuspend, ResponseCode: QuitSuspend, KeyCodes: []unison.KeyCode{unison.KeyReturn,
+			unison.KeyNumPadEnter}},
+	}
+	dialog, err := unison.NewDialog(unison.DefaultDialogTheme.QuestionIcon, unison.DefaultDialogTheme.QuestionIconInk,
+		panel, buttons, unison.NotResizableWindowOption())
+	if err != nil {
+		errs.Log(err)
+		return QuitCancel
+	}
+	dialog.Window().SetTitle(assets.CapTransfers)
+	return dialog.RunModal()
+}
+
+// Answers of DialogToSelectRevision
+const (
+	RevisionCancel   = unison.ModalResponseCancel
+	RevisionDownload = unison.ModalResponseUserBase + iota
+	RevisionRestore
+)
+
+// RevisionRowType -revision of a file as shown by DialogToSelectRevision
+type RevisionRowType struct {
+	Modified string
+	Size     string
+	Hash     string
+	Current  bool
+}
+
+func (r RevisionRowType) String() string {
+	text := fmt.Sprintf(assets.TxtRevision, r.Modified, r.Size, r.Hash)
+	if r.Current {
+		text += assets.TxtCurrentRevision
+	}
+	return text
+}
+
+// DialogToSelectRevision -show the revisions of a file, newest first, returns the action chosen and the index
+// of the selected revision, the current revision cannot be restored
+func DialogToSelectRevision(name string, revisions []RevisionRowType) (int, int) {
+	var dialog *unison.Dialog
+	var err error
+	panel := unison.NewPanel()
+	panel.SetLayout(&unison.FlexLayout{
+		Columns:  1,
+		HSpacing: 1,
+		VSpacing: unison.StdVSpacing,
+	})
+	lblName := unison.NewLabel()
+	lblName.Font = unison.LabelFont
+	lblName.SetTitle(name)
+	panel.AddChild(lblName)
+	list := unison.NewList[RevisionRowType]()
+	list.SetAllowMultipleSelection(false)
+	list.Append(revisions...)
+	list.NewSelectionCallback = func() {
+		index := list.Selection.FirstSet()
+		dialog.Button(RevisionDownload).SetEnabled(index >= 0)
+		dialog.Button(RevisionRestore).SetEnabled(index >= 0 && !revisions[index].Current)
+	}
+	list.DoubleClickCallback = func() {
+		if list.Selection.FirstSet() >= 0 {
+			dialog.StopModal(RevisionDownload)
+		}
+	}
+	scroller := unison.NewScrollPanel()
+	scroller.SetContent(list, behavior.Fill, behavior.Fill)
+	scroller.SetLayoutData(&unison.FlexLayoutData{
+		SizeHint: unison.NewSize(revisionsWidth, revisionsHeight),
+		HAlign:   align.Fill,
+		VAlign:   align.Fill,
+		HGrab:    true,
+		VGrab:    true,
+	})
+	panel.AddChild(scroller)
+	buttons := []*unison.DialogButtonInfo{
+		{Title: assets.CapClose, ResponseCode: RevisionCancel, KeyCodes: []unison.KeyCode{unison.KeyEscape}},
+		{Title: assets.CapDownload, ResponseCode: RevisionDownload},
+		{Title: assets.CapRestore, ResponseCode: RevisionRestore},
+	}
+	if dialog, err = unison.NewDialog(nil, nil, panel, buttons, unison.NotResizableWindowOption()); err != nil {
+		errs.Log(err)
+		return RevisionCancel, -1
+	}
+	dialog.Window().SetTitle(assets.CapVersionHistory)
+	dialog.Button(RevisionDownload).SetEnabled(false)
+	dialog.Button(RevisionRestore).SetEnabled(false)
+	response := dialog.RunModal()
+	return response, list.Selection.FirstSet()
+}
+
+// DialogToConfirmPermanentDelete -ask before the selected entries are deleted beyond recovery
+func DialogToConfirmPermanentDelete(count int) bool {
+	panel := unison.NewMessagePanel(fmt.Sprintf(assets.TxtPermanentDelete, count), assets.TxtPermanentDeleteDetail)
+	buttons := []*unison.DialogButtonInfo{
+		unison.NewCancelButtonInfo(),
+		{Title: assets.CapDeletePermanently, ResponseCode: unison.ModalResponseOK},
+	}
+	dialog, err := unison.NewDialog(unison.DefaultDialogTheme.WarningIcon, unison.DefaultDialogTheme.WarningIconInk,
+		panel, buttons, unison.NotResizableWindowOption())
+	if err != nil {
+		errs.Log(err)
+		return false
+	}
+	dialog.Window().SetTitle(assets.CapTrash)
+	return dialog.RunModal() == unison.ModalResponseOK
+}
+
+// DialogToQueryMoveTarget -ask for the Dropbox folder to move items to, "" if cancelled
+func DialogToQueryMoveTarget() string {
+	var dialog *unison.Dialog
+	var err error
+	panel := unison.NewPanel()
+	panel.SetLayout(&unison.FlexLayout{
+		Columns:  2,
+		HSpacing: 10,
+		VSpacing: unison.StdVSpacing,
+	})
+	lblFolder := unison.NewLabel()
+	lblFolder.Font = unison.LabelFont
+	lblFolder.SetTitle(assets.CapDestinationFolder)
+	inpFolder := unison.NewField()
+	inpFolder.Font = unison.FieldFont
+	inpFolder.MinimumTextWidth = inpTextSizeMax
+	inpFolder.SetText(api.DbxPathSeparator)
+	inpFolder.ModifiedCallback = func(before, after *unison.FieldState) {
+		dialog.Button(unison.ModalResponseOK).SetEnabled(strings.HasPrefix(after.Text, api.DbxPathSeparator))
+	}
+	panel.AddChild(lblFolder)
+	panel.AddChild(inpFolder)
+	if dialog, err = unison.NewDialog(nil, nil, panel,
+		[]*unison.DialogButtonInfo{unison.NewCancelButtonInfo(), unison.NewOKButtonInfo()},
+		unison.NotResizableWindowOption()); err != nil {
+		errs.Log(err)
+		return ""
+	}
+	dialog.Window().SetTitle(assets.CapMoveTo)
+	if dialog.RunModal() != unison.ModalResponseOK {
+		return ""
+	}
+	return inpFolder.Text()
+}
@@ -10,6 +10,9 @@ import (
 	"Dropbox_REST_Client/api"
 	"Dropbox_REST_Client/assets"
 	"Dropbox_REST_Client/dialogs"
+	"Dropbox_REST_Client/transfer"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/richardwilkes/toolbox/errs"
 	"github.com/richardwilkes/toolbox/fatal"
@@ -18,6 +21,7 @@ import (
 	"github.com/richardwilkes/unison/enums/align"
 	"math"
 	"path"
+	"path/filepath"
 	"slices"
 	"strings"
 )
@@ -28,9 +32,19 @@ import (
 
 const dragKey = "fileSystemRow"
 const useBatchDelete = 10
+const zipSuffix = ".zip"
 
+var dbxClient *api.Client // handed over by NewFileSystemTable
+
+// TransferProgressCallback -called on the UI thread with the progress of running uploads and downloads
+var TransferProgressCallback func(progress transfer.ProgressType)
+
+// AuthorizationRequiredCallback -called when Dropbox rejects the authorization, e.g. to open the settings dialog
+var AuthorizationRequiredCallback func()
 var fileSystemTable *unison.Table[*fileSystemRow]
 var selectedRows []*fileSystemRow
+var dropCopies bool      // the last drop copied the rows instead of moving them
+var copiedPaths []string // Dropbox paths put on the clipboard by Copy
 
 type Caption struct {
 	Title string
@@ -43,13 +57,27 @@ type TableHeaderDescription struct {
 }
 
 type fileSystemItem struct {
-	Name     string
-	DbxId    string
-	Modified string
-	Size     string
-	Hash     string
-	Path     string
-	IsFolder bool
+	Name      string
+	DbxId     string
+	Modified  string
+	Size      string
+	Hash      string
+	Path      string
+	IsFolder  bool
+	Bytes     int64
+	IsDeleted bool
+}
+
+type moveJobType struct {
+	row      *fileSystemRow
+	from     string
+	to       string
+	metadata *api.FileItemMetadataType
+}
+
+type uploadJobType struct {
+	path     string
+	metadata *api.FileItemType
 }
 
 type fileSystemRow struct {
@@ -76,7 +104,9 @@ var fileSystemTableDescription = TableHeaderDescription{
 	},
 }
 
-func NewFileSystemTable() (*unison.Table[*fileSystemRow], *unison.TableHeader[*fileSystemRow]) {
+// NewFileSystemTable -create the table of the Dropbox files and folders, client makes all calls of the data model
+func NewFileSystemTable(client *api.Client) (*unison.Table[*fileSystemRow], *unison.TableHeader[*fileSystemRow]) {
+	dbxClient = client
 	unison.DefaultTableTheme.IndirectSelectionInk = unison.DefaultTableTheme.BackgroundInk
 	unison.DefaultTableTheme.OnIndirectSelectionInk = unison.DefaultTableTheme.OnBackgroundInk
 	unison.DefaultTableTheme.BandingInk = unison.DefaultTableTheme.BackgroundInk
@@ -98,13 +128,20 @@ func NewFileSystemTable() (*unison.Table[*fileSystemRow], *unison.TableHeader[*f
 		unison.NewTableColumnHeader[*fileSystemRow](fileSystemTableDescription.Captions[4].Title, ""),
 		unison.NewTableColumnHeader[*fileSystemRow](fileSystemTableDescription.Captions[5].Title, ""),
 	)
+	defaultMouseDrag := fileSystemTable.MouseDragCallback
+	fileSystemTable.MouseDragCallback = func(where unison.Point, button int, mod unison.Modifiers) bool {
+		// deleted rows and search results can not be dragged, a drop would copy them
+		return defaultMouseDrag(where, button, mod) || trashMode || searchMode
+	}
 	fileSystemTable.InstallDragSupport(nil, dragKey, "Row", "Rows")
 	unison.InstallDropSupport[*fileSystemRow, any](fileSystemTable, dragKey,
 		func(from, to *unison.Table[*fileSystemRow]) bool {
-			return from == to
+			// holding Alt (Option on macOS) while dropping copies the rows
+			return from == to && !from.Window().CurrentKeyModifiers().OptionDown()
 		},
 		func(from, to *unison.Table[*fileSystemRow], move bool) *unison.UndoEdit[any] {
 			selectedRows = nil // clear selection
+			dropCopies = !move
 			for _, row := range from.SelectedRows(true) {
 				selectedRows = append(selectedRows, row) // copy selection to "var selectedRows []*fileSystemRow"
 			}
@@ -114,7 +151,21 @@ func NewFileSystemTable() (*unison.Table[*fileSystemRow], *unison.TableHeader[*f
 		/* func(undo *unison.UndoEdit[any], from, to *unison.Table[*fileSystemRow], move bool) {} */
 	)
 	fileSystemTable.DropOccurredCallback = func() {
-		DropboxMoveFileItems() // perform move operation
+		if dropCopies {
+			DropboxCopyDroppedItems(fileSystemTable.SelectedRows(true)) // the dropped clones are selected
+		} else {
+			DropboxMoveFileItems() // perform move operation
+		}
+	}
+	fileSystemTable.InstallCmdHandlers(unison.CopyItemID,
+		func(any) bool { return !trashMode && fileSystemTable.HasSelection() }, func(any) { CopyFileItems() })
+	fileSystemTable.InstallCmdHandlers(unison.PasteItemID,
+		func(any) bool { return !trashMode && !searchMode && len(copiedPaths) > 0 },
+		func(any) { DropboxPasteFileItems() })
+	fileSystemTable.DoubleClickCallback = func() {
+		if searchMode {
+			RevealSearchResult()
+		}
 	}
 	fileSystemTable.KeyUpCallback = func(keyCode unison.KeyCode, mod unison.Modifiers) bool {
 		if keyCode == unison.KeyEscape {
@@ -220,15 +271,20 @@ func (d *fileSystemRow) SetOpen(open bool) {
 	d.open = open
 	// chevron open, no children loaded
 	if open && len(d.children) == 0 {
-		entries, err := api.ListFolders(d.M.DbxId, false, 2000)
-		if err == nil {
-			for _, entry := range entries {
-				row := newFileSystemRow(tid.MustNewTID('a'), *entry, d)
-				children = append(children, row)
-			}
-			if len(children) > 0 {
-				d.SetChildren(children)
-			}
+		ctx, cancel := CallContext()
+		entries, err := dbxClient.ListFolders(ctx, d.M.DbxId, false, 2000)
+		cancel()
+		if err != nil {
+			d.open = false
+			DisplayDropboxError(assets.TxtDropboxError, err)
+			return
+		}
+		for _, entry := range entries {
+			row := newFileSystemRow(tid.MustNewTID('a'), *entry, d)
+			children = append(children, row)
+		}
+		if len(children) > 0 {
+			d.SetChildren(children)
 		}
 	}
 	fileSystemTable.SyncToModel()
@@ -265,10 +321,12 @@ func newFileSystemRow(id tid.TID, data api.FileItemType, parent *fileSystemRow)
 			data.Name,
 			data.Id,
 			convertTimestamp(data.ClientModified),
-			convertBytes(data.Size),
+			ConvertBytes(data.Size),
 			data.ContentHash,
 			data.PathDisplay,
-			data.Tag == api.DbxFolder},
+			data.Tag == api.DbxFolder,
+			data.Size,
+			data.Tag == api.DbxDeleted},
 	}
 	return row
 }
@@ -282,26 +340,37 @@ func sync() {
 
 func DropboxReadRootFolders() {
 	var rootfolders []*fileSystemRow
-	folders, err := api.ListFolders("", false, 2000)
-	if err == nil {
-		for _, entry := range folders {
-			row := newFileSystemRow(tid.MustNewTID('a'), *entry, nil)
-			rootfolders = append(rootfolders, row)
-		}
-		if len(rootfolders) > 0 {
-			fileSystemTable.SetRootRows(rootfolders)
-			fileSystemTable.SelectByIndex(0)
-		}
-		sync()
+	if trashMode {
+		dropboxReadTrash()
+		return
 	}
+	if searchMode {
+		// the folders are read again, e.g. after an entry was not found, the results are left
+		searchMode = false
+		notifyViewMode()
+	}
+	ctx, cancel := CallContext()
+	defer cancel()
+	folders, err := dbxClient.ListFolders(ctx, "", false, 2000)
+	if err != nil {
+		DisplayDropboxError(assets.TxtDropboxError, err)
+		return
+	}
+	for _, entry := range folders {
+		row := newFileSystemRow(tid.MustNewTID('a'), *entry, nil)
+		rootfolders = append(rootfolders, row)
+	}
+	if len(rootfolders) > 0 {
+		fileSystemTable.SetRootRows(rootfolders)
+		fileSystemTable.SelectByIndex(0)
+	}
+	sync()
 }
 
 func DropboxMoveFileItems() {
 	var fromPath, toPath string
-	var err error
-	var m *api.FileItemMetadataType
+	var jobs []*moveJobType
 	for _, row := range selectedRows {
-		m = nil
 		if row._parent != nil { // parent before dnd
 			fromPath = row._parent.M.Path
 		} else {
@@ -315,61 +384,201 @@ func DropboxMoveFileItems() {
 		if fromPath == toPath {
 			continue
 		}
-		fromPath = path.Join(fromPath, row.M.Name)
-		toPath = path.Join(toPath, row.M.Name)
-		m, err = api.MoveFiles(fromPath, toPath)
-		if err == nil {
-			row.M.Path = m.Metadata.PathDisplay
-			row.M.Modified = convertTimestamp(m.Metadata.ClientModified)
-			row.M.Name = m.Metadata.Name
-			row._parent = row.Parent()
-			if row.parent != nil {
-				row.parent.SetOpen(true) // expand new parent
-			}
-		} else {
-			if row._parent != nil {
-				row._parent.AddChild(row) // old parent (drag source)
+		jobs = append(jobs, &moveJobType{
+			row:  row,
+			from: path.Join(fromPath, row.M.Name),
+			to:   path.Join(toPath, row.M.Name),
+		})
+	}
+	selectedRows = nil
+	if len(jobs) == 0 {
+		sync() // dropped into the folder they came from
+		return
+	}
+	var failures []error // entries of a batch that could not be moved
+	runOperation(func(ctx context.Context) error {
+		var err error
+		if len(jobs) == 1 {
+			jobs[0].metadata, err = dbxClient.MoveFiles(ctx, jobs[0].from, jobs[0].to)
+			return err
+		}
+		// many rows are moved in one job, every entry succeeds or fails on its own
+		var entries []api.RelocationPathType
+		for _, job := range jobs {
+			entries = append(entries, api.RelocationPathType{FromPath: job.from, ToPath: job.to})
+		}
+		result, err := dbxClient.BatchMoveFiles(ctx, entries, jobProgress)
+		if err != nil {
+			return err
+		}
+		// the entries follow the order of the jobs, a job without entry stays where it was
+		for i, job := range jobs[:min(len(jobs), len(result.Entries))] {
+			if e := result.Entries[i].Err(); e != nil {
+				failures = append(failures, fmt.Errorf("%s: %w", job.from, e))
+			} else {
+				job.metadata = &api.FileItemMetadataType{Metadata: result.Entries[i].Success}
 			}
-			if row.parent != nil {
-				row.parent.DeleteChild(row) // new parent
+		}
+		return nil
+	}, func(err error) {
+		for _, job := range jobs {
+			row := job.row
+			if job.metadata != nil {
+				row.M.Path = job.metadata.Metadata.PathDisplay
+				row.M.Modified = convertTimestamp(job.metadata.Metadata.ClientModified)
+				row.M.Name = job.metadata.Metadata.Name
+				row._parent = row.Parent()
+				if row.parent != nil {
+					row.parent.SetOpen(true) // expand new parent
+				}
+			} else { // failed or not processed
+				if row._parent != nil {
+					row._parent.AddChild(row) // old parent (drag source)
+				}
+				if row.parent != nil {
+					row.parent.DeleteChild(row) // new parent
+				}
+				row.parent = row._parent // restore parent
 			}
-			row.parent = row._parent // restore parent
-			break
 		}
+		sync()
+		if err != nil {
+			DisplayDropboxError(assets.TxtDropboxError, err)
+		} else if len(failures) > 0 {
+			dialogs.DialogToDisplaySystemError(assets.ErrorMoving, errors.Join(failures...))
+		}
+	})
+}
+
+// DropboxCopyDroppedItems -copy the rows dropped with Alt held, the dropped clones are replaced by the rows
+// of the copies
+func DropboxCopyDroppedItems(clones []*fileSystemRow) {
+	var entries []api.RelocationPathType
+	var targets []*fileSystemRow
+	for _, clone := range clones {
+		toPath := api.DbxPathSeparator
+		if clone.parent != nil {
+			toPath = clone.parent.M.Path
+			targets = append(targets, clone.parent)
+		}
+		entries = append(entries, api.RelocationPathType{
+			FromPath: clone.M.Path,
+			ToPath:   path.Join(toPath, clone.M.Name),
+		})
+		removeRow(clone)
 	}
 	sync()
-	selectedRows = nil
-	if err != nil {
-		dialogs.DialogToDisplaySystemError(assets.TxtDropboxError, err)
+	dropboxCopyItems(entries, targets)
+}
+
+// CopyFileItems -put the selected Dropbox items on the clipboard for Paste
+func CopyFileItems() {
+	copiedPaths = nil
+	for _, row := range fileSystemTable.SelectedRows(true) {
+		copiedPaths = append(copiedPaths, row.M.Path)
 	}
 }
 
-func DropboxCreateFolder(folderName string) {
-	var parent string
-	var parentRow *fileSystemRow = nil
-	var folder *api.FileItemType
-	var err error
+// DropboxPasteFileItems -copy the items on the clipboard into the selected Dropbox folder
+func DropboxPasteFileItems() {
+	var entries []api.RelocationPathType
+	var targets []*fileSystemRow
+	target, targetRow, ok := selectedTargetFolder()
+	if !ok {
+		return
+	}
+	if targetRow != nil {
+		targets = append(targets, targetRow)
+	}
+	for _, p := range copiedPaths {
+		entries = append(entries, api.RelocationPathType{FromPath: p, ToPath: path.Join(target, path.Base(p))})
+	}
+	dropboxCopyItems(entries, targets)
+}
+
+// dropboxCopyItems -copy in the background, existing destinations are kept and the copies renamed,
+// the rows of the copies are inserted and the target folders opened
+func dropboxCopyItems(entries []api.RelocationPathType, targets []*fileSystemRow) {
+	var result *api.RelocationBatchResultType
+	runOperation(func(ctx context.Context) error {
+		var err error
+		if len(entries) == 1 {
+			var metadata *api.FileItemMetadataType
+			if metadata, err = dbxClient.CopyFiles(ctx, entries[0].FromPath, entries[0].ToPath); err == nil {
+				result = &api.RelocationBatchResultType{Entries: []api.RelocationBatchEntryType{
+					{Tag: "success", Success: metadata.Metadata},
+				}}
+			}
+			return err
+		}
+		result, err = dbxClient.BatchCopyFiles(ctx, entries, jobProgress)
+		return err
+	}, func(err error) {
+		var failures []error
+		if result != nil {
+			// the entries follow the order of the request, surplus entries are ignored
+			for i, entry := range result.Entries[:min(len(entries), len(result.Entries))] {
+				if e := entry.Err(); e != nil {
+					failures = append(failures, fmt.Errorf("%s: %w", entries[i].FromPath, e))
+				} else {
+					insertUploadedRow(entry.Success)
+				}
+			}
+		}
+		for _, target := range targets {
+			target.SetOpen(true) // loads the children if they have not been read yet
+		}
+		sync()
+		if err != nil {
+			DisplayDropboxError(assets.ErrorCopying, err)
+		} else if len(failures) > 0 {
+			dialogs.DialogToDisplaySystemError(assets.ErrorCopying, errors.Join(failures...))
+		}
+	})
+}
+
+// removeRow -take a row out of the tree, a folder left without rows reads its children again when it is opened
+func removeRow(row *fileSystemRow) {
+	if row.parent != nil {
+		if row.parent.DeleteChild(row); len(row.parent.children) == 0 {
+			row.parent.children = nil
+		}
+		return
+	}
+	fileSystemTable.SetRootRows(slices.DeleteFunc(slices.Clone(fileSystemTable.RootRows()),
+		func(r *fileSystemRow) bool { return r == row }))
+}
+
+// selectedTargetFolder -Dropbox folder for new items, the selected folder or the root folder if nothing is selected
+func selectedTargetFolder() (string, *fileSystemRow, bool) {
 	selectedrows := fileSystemTable.SelectedRows(true)
 	switch len(selectedrows) {
 	case 0:
-		parent = api.DbxPathSeparator
+		return api.DbxPathSeparator, nil, true
 	case 1:
 		if selectedrows[0].M.IsFolder {
-			parent = selectedrows[0].M.Path
-			parentRow = selectedrows[0]
-		} else {
-			dialogs.DialogToDisplayErrorMessage(assets.ErrorNoFolderSelected, "")
-			return
+			return selectedrows[0].M.Path, selectedrows[0], true
 		}
-		break
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorNoFolderSelected, "")
 	default:
 		dialogs.DialogToDisplayErrorMessage(assets.ErrorTooManySelections, "")
+	}
+	return "", nil, false
+}
+
+func DropboxCreateFolder(folderName string) {
+	var folder *api.FileItemType
+	var err error
+	parent, parentRow, ok := selectedTargetFolder()
+	if !ok {
 		return
 	}
 	_path := path.Join(parent, folderName)
-	folder, err = api.CreateFolder(_path)
+	ctx, cancel := CallContext()
+	defer cancel()
+	folder, err = dbxClient.CreateFolder(ctx, _path)
 	if err != nil {
-		dialogs.DialogToDisplaySystemError(assets.ErrorCreatingFolder, err)
+		DisplayDropboxError(assets.ErrorCreatingFolder, err)
 		return
 	}
 	row := newFileSystemRow(tid.MustNewTID('a'), *folder, parentRow)
@@ -384,99 +593,316 @@ func DropboxCreateFolder(folderName string) {
 	sync()
 }
 
+// CheckUploadTarget -check the selection before the local items to upload are chosen
+func CheckUploadTarget() bool {
+	_, _, ok := selectedTargetFolder()
+	return ok
+}
+
+// DropboxUploadItems -recreate the local folders and upload the files below the selected Dropbox folder
+func DropboxUploadItems(folders, files []*api.FileSysStructureType) {
+	var jobs []*uploadJobType
+	var tasks []*transfer.TaskType
+	target, targetRow, ok := selectedTargetFolder()
+	if !ok {
+		return
+	}
+	// folders come first, parents before their children
+	for _, folder := range folders {
+		jobs = append(jobs, &uploadJobType{path: path.Join(target, folder.DbxPath)})
+	}
+	for _, file := range files {
+		tasks = append(tasks, &transfer.TaskType{
+			Kind:    transfer.Upload,
+			OSPath:  file.OSPath,
+			DbxPath: path.Join(target, file.DbxPath, file.FileName),
+			Size:    file.Size,
+		})
+	}
+	runOperation(func(ctx context.Context) error {
+		if len(jobs) == 0 {
+			return nil
+		}
+		// the whole hierarchy is created in one job, folders that already exist are kept
+		var paths []string
+		for _, job := range jobs {
+			paths = append(paths, job.path)
+		}
+		folders, err := dbxClient.EnsureFolders(ctx, paths, jobProgress)
+		for i, folder := range folders {
+			jobs[i].metadata = folder
+		}
+		return err
+	}, func(err error) {
+		for _, job := range jobs {
+			if job.metadata != nil {
+				insertUploadedRow(*job.metadata)
+			}
+		}
+		if targetRow != nil {
+			targetRow.SetOpen(true) // loads the children if they have not been read yet
+		}
+		sync()
+		if err != nil {
+			DisplayDropboxError(assets.ErrorUploading, err)
+			return
+		}
+		transferQueue.Add(tasks...) // the rows of the files are inserted as they are uploaded
+	})
+}
+
+// insertUploadedRow -add an uploaded or copied item to the tree or update its row, items below folders whose children
+// have not been read yet are skipped, they show up when the folder is opened
+func insertUploadedRow(metadata api.FileItemType) {
+	var parent *fileSystemRow
+	var children []*fileSystemRow
+	dir := path.Dir(metadata.PathDisplay)
+	if dir == api.DbxPathSeparator {
+		children = fileSystemTable.RootRows()
+	} else {
+		if parent = findRow(fileSystemTable.RootRows(), dir); parent == nil || parent.children == nil {
+			return
+		}
+		children = parent.children
+	}
+	row := newFileSystemRow(tid.MustNewTID('a'), metadata, parent)
+	if row.M.IsFolder {
+		row.children = []*fileSystemRow{} // a new folder only contains what is uploaded into it
+	}
+	for _, child := range children {
+		if strings.EqualFold(child.M.Path, row.M.Path) {
+			child.M = row.M
+			return
+		}
+	}
+	if parent != nil {
+		parent.children = append(parent.children, row)
+	} else {
+		fileSystemTable.SetRootRows(append(children, row))
+	}
+}
+
+// findRow -search the loaded rows for a Dropbox path
+func findRow(rows []*fileSystemRow, p string) *fileSystemRow {
+	for _, row := range rows {
+		if strings.EqualFold(row.M.Path, p) {
+			return row
+		}
+		if row.M.IsFolder && strings.HasPrefix(strings.ToLower(p), strings.ToLower(row.M.Path)+api.DbxPathSeparator) {
+			return findRow(row.children, p)
+		}
+	}
+	return nil
+}
+
 func DropboxDeleteFileItems() {
-	var err error
-	var row *fileSystemRow
 	var isfolder = false
-	var i int
-	rootrows := fileSystemTable.RootRows()
+	var ids, deleted []string
 	selectedrows := fileSystemTable.SelectedRows(true)
-	for i, row = range selectedrows {
+	for _, row := range selectedrows {
 		if row.M.IsFolder {
 			isfolder = true
 		}
+		ids = append(ids, row.M.DbxId)
 	}
-	if isfolder || i >= useBatchDelete {
-		// batch delete
-		err = dropboxFileBatchDelete(selectedrows, rootrows)
-	} else {
-		// single delete
-		err = dropboxFileSingleDelete(selectedrows, rootrows)
+	runOperation(func(ctx context.Context) error {
+		var err error
+		if isfolder || len(ids) > useBatchDelete {
+			// batch delete
+			deleted, err = dropboxFileBatchDelete(ctx, ids)
+		} else {
+			// single delete
+			deleted, err = dropboxFileSingleDelete(ctx, ids)
+		}
+		return err
+	}, func(err error) {
+		removeDeletedRows(selectedrows, deleted)
+		sync()
+		if err != nil {
+			DisplayDropboxError(assets.TxtDropboxError, err)
+		}
+	})
+}
+
+// dropboxFileSingleDelete -delete items one by one, returns the ids deleted so far
+func dropboxFileSingleDelete(ctx context.Context, ids []string) ([]string, error) {
+	var deleted []string
+	for _, id := range ids {
+		metadata, err := dbxClient.DeleteFile(ctx, id)
+		if err != nil {
+			return deleted, err
+		}
+		if metadata.Metadata.Id == id {
+			deleted = append(deleted, id)
+		}
 	}
-	sync()
+	return deleted, nil
+}
+
+// dropboxFileBatchDelete -delete items in one async job, returns the ids deleted
+func dropboxFileBatchDelete(ctx context.Context, ids []string) ([]string, error) {
+	var deleted []string
+	metadata, err := dbxClient.BatchDeleteFiles(ctx, ids, jobProgress)
 	if err != nil {
-		dialogs.DialogToDisplaySystemError(assets.TxtDropboxError, err)
+		return nil, err
 	}
+	for _, m := range metadata.Entries {
+		if m.Metadata.Id != "" {
+			deleted = append(deleted, m.Metadata.Id)
+		}
+	}
+	return deleted, nil
 }
 
-func dropboxFileSingleDelete(selectedrows []*fileSystemRow, rootrows []*fileSystemRow) error {
-	var err error
-	var metadata *api.FileItemMetadataType
+// removeDeletedRows -remove the rows of deleted items from the tree
+func removeDeletedRows(selectedrows []*fileSystemRow, deleted []string) {
+	rootrows := fileSystemTable.RootRows()
 	rootcount := len(rootrows)
 	for _, row := range selectedrows {
-		metadata, err = api.DeleteFile(row.M.DbxId)
-		if err != nil {
-			return err
+		if !slices.Contains(deleted, row.M.DbxId) {
+			continue
 		}
-		if metadata.Metadata.Id == row.M.DbxId {
-			if row.parent != nil {
-				row.parent.DeleteChild(row)
-				row = nil
-			} else {
-				for j, rootrow := range rootrows {
-					if rootrow == row {
-						rootrows = slices.Delete(rootrows, j, j+1)
-						break
-					}
-					j++
-				}
-			}
+		if row.parent != nil {
+			row.parent.DeleteChild(row)
+		} else {
+			rootrows = slices.DeleteFunc(rootrows, func(r *fileSystemRow) bool { return r == row })
 		}
 	}
 	// at least 1 rootrow removed
 	if rootcount > len(rootrows) {
 		fileSystemTable.SetRootRows(rootrows)
 	}
-	return nil
 }
 
-func dropboxFileBatchDelete(selectedrows []*fileSystemRow, rootrows []*fileSystemRow) error {
-	var err error
-	var _path []string
-	var row *fileSystemRow
-	var metadata *api.FileItemBatchDeletedType
-	rootcount := len(rootrows)
-	for _, row = range selectedrows {
-		_path = append(_path, row.M.DbxId)
+// DropboxDownloadFileItems -download the selected files into a local folder
+func DropboxDownloadFileItems(dir string) {
+	var files, folders []*fileSystemRow
+	mode := dialogs.FolderDownloadCancel
+	for _, row := range fileSystemTable.SelectedRows(true) {
+		if row.M.IsFolder {
+			folders = append(folders, row)
+		} else {
+			files = append(files, row)
+		}
 	}
-	metadata, err = api.BatchDeleteFiles(_path)
-	if err != nil {
-		return err
+	if len(files) == 0 && len(folders) == 0 {
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorNoFileSelected, "")
+		return
 	}
-	for _, row = range selectedrows {
-		for _, m := range metadata.Entries {
-			if m.Metadata.Id == row.M.DbxId {
-				if row.parent != nil {
-					row.parent.DeleteChild(row)
-					row = nil
-				} else {
-					for j, rootrow := range rootrows {
-						if rootrow == row {
-							rootrows = slices.Delete(rootrows, j, j+1)
-							break
-						}
-						j++
-					}
-				}
-				break
+	if len(folders) > 0 {
+		if mode = dialogs.DialogToQueryFolderDownload(); mode == dialogs.FolderDownloadCancel {
+			return
+		}
+	}
+	var tasks []*transfer.TaskType
+	folderJobs := make(map[string]string) // Dropbox path -> local path, a zip file or the target folder
+	for _, row := range files {
+		tasks = append(tasks, &transfer.TaskType{
+			Kind:    transfer.Download,
+			OSPath:  filepath.Join(dir, row.M.Name),
+			DbxPath: row.M.Path,
+			Size:    row.M.Bytes,
+		})
+	}
+	for _, row := range folders {
+		if mode == dialogs.FolderDownloadZip {
+			folderJobs[row.M.Path] = filepath.Join(dir, row.M.Name+zipSuffix)
+		} else {
+			folderJobs[row.M.Path] = dir
+		}
+	}
+	transferQueue.Add(tasks...)
+	if len(folderJobs) == 0 {
+		return
+	}
+	runOperation(func(ctx context.Context) error {
+		var err error
+		for dbxPath, osPath := range folderJobs {
+			if mode == dialogs.FolderDownloadZip {
+				_, err = dbxClient.DownloadZipToFile(ctx, dbxPath, osPath, nil)
+			} else {
+				_, err = dbxClient.DownloadFolder(ctx, dbxPath, osPath, nil)
+			}
+			if err != nil {
+				return err
 			}
 		}
+		return nil
+	}, func(err error) {
+		if err != nil {
+			DisplayDropboxError(assets.ErrorDownloading, err)
+		}
+	})
+}
+
+// DropboxVersionHistory -show the revisions of the selected file, a revision can be restored or downloaded
+func DropboxVersionHistory() {
+	selected := fileSystemTable.SelectedRows(true)
+	if len(selected) != 1 || selected[0].M.IsFolder || selected[0].M.IsDeleted {
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorNoFileSelected, "")
+		return
 	}
-	// at least 1 rootrow removed
-	if rootcount > len(rootrows) {
-		fileSystemTable.SetRootRows(rootrows)
+	row := selected[0]
+	ctx, cancel := CallContext()
+	revisions, err := dbxClient.ListRevisions(ctx, row.M.Path, api.DbxMaxRevisions)
+	cancel()
+	if err != nil {
+		DisplayDropboxError(assets.ErrorListingRevisions, err)
+		return
+	}
+	var rows []dialogs.RevisionRowType
+	for i, revision := range revisions.Entries {
+		rows = append(rows, dialogs.RevisionRowType{
+			Modified: convertTimestamp(revision.ServerModified),
+			Size:     ConvertBytes(revision.Size),
+			Hash:     revision.ContentHash,
+			Current:  i == 0,
+		})
+	}
+	response, index := dialogs.DialogToSelectRevision(row.M.Path, rows)
+	if index < 0 {
+		return
+	}
+	revision := revisions.Entries[index]
+	switch response {
+	case dialogs.RevisionRestore:
+		dropboxRestoreRevision(row, revision.Rev)
+	case dialogs.RevisionDownload:
+		dialog := unison.NewSaveDialog()
+		dialog.SetInitialFileName(row.M.Name)
+		if !dialog.RunModal() {
+			return
+		}
+		osPath, ok := unison.ValidateSaveFilePath(dialog.Path(), "", false)
+		if !ok {
+			return
+		}
+		runOperation(func(ctx context.Context) error {
+			_, err := dbxClient.DownloadToFile(ctx, api.RevisionPath(revision.Rev), osPath, nil)
+			return err
+		}, func(err error) {
+			if err != nil {
+				DisplayDropboxError(assets.ErrorDownloading, err)
+			}
+		})
 	}
-	return nil
+}
+
+// dropboxRestoreRevision -make rev the current content of the file shown in row
+func dropboxRestoreRevision(row *fileSystemRow, rev string) {
+	var metadata *api.FileItemType
+	runOperation(func(ctx context.Context) error {
+		var err error
+		metadata, err = dbxClient.RestoreFile(ctx, row.M.Path, rev)
+		return err
+	}, func(err error) {
+		if err != nil {
+			DisplayDropboxError(assets.ErrorRestoring, err)
+			return
+		}
+		row.M = newFileSystemRow(row.id, *metadata, row.parent).M
+		sync()
+	})
 }
 
 func DropboxRefreshData() {
@@ -486,6 +912,33 @@ func DropboxRefreshData() {
 	DropboxReadRootFolders()
 }
 
+// DisplayDropboxError -show a meaningful message for Dropbox errors and take the matching recovery action
+func DisplayDropboxError(primary string, err error) {
+	var dbxerr *api.DropboxError
+	detail := err.Error()
+	if errors.As(err, &dbxerr) {
+		detail = dbxerr.Message()
+	}
+	switch {
+	case errors.Is(err, api.ErrInvalidAccessToken):
+		dialogs.DialogToDisplayErrorMessage(assets.TxtAuthorizationExpired, detail)
+		if AuthorizationRequiredCallback != nil {
+			AuthorizationRequiredCallback()
+		}
+	case errors.Is(err, api.ErrNotFound):
+		dialogs.DialogToDisplayErrorMessage(assets.TxtItemNotFound, detail)
+		DropboxRefreshData()
+	case errors.Is(err, api.ErrConflict):
+		dialogs.DialogToDisplayErrorMessage(assets.TxtItemConflict, detail)
+	case errors.Is(err, api.ErrInsufficientSpace):
+		dialogs.DialogToDisplayErrorMessage(assets.TxtInsufficientSpace, detail)
+	case errors.Is(err, api.ErrRateLimited):
+		dialogs.DialogToDisplayErrorMessage(assets.TxtRateLimited, detail)
+	default:
+		dialogs.DialogToDisplaySystemError(primary, err)
+	}
+}
+
 func addText(parent *unison.Panel, text string, ink unison.Ink, font unison.Font) {
 	tx := unison.NewText(text, &unison.TextDecoration{Font: font})
 	label := unison.NewLabel()
@@ -495,7 +948,8 @@ func addText(parent *unison.Panel, text string, ink unison.Ink, font unison.Font
 	parent.AddChild(label)
 }
 
-func convertBytes(b int64) string {
+// ConvertBytes -human readable size
+func ConvertBytes(b int64) string {
 	if b == 0 {
 		return ""
 	}
@@ -0,0 +1,187 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Background operations, using Unison library (c) Richard A. Wilkes
+// https://github.com/richardwilkes/unison
+// ---------------------------------------------------------------------------------------------------------------------
+
+package models
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/dialogs"
+	"Dropbox_REST_Client/transfer"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/richardwilkes/toolbox/errs"
+	"github.com/richardwilkes/unison"
+	"time"
+)
+
+const callTimeout = 60 * time.Second // deadline for calls made on the UI thread
+
+var operationCtx context.Context
+var cancelOperation context.CancelFunc
+var runningOperations int
+var transferQueue *transfer.ManagerType
+
+// TransfersChangedCallback -called on the UI thread when transfers are added or removed or change their state
+var TransfersChangedCallback func()
+
+// TransfersIdleCallback -called on the UI thread when the last transfer has ended
+var TransfersIdleCallback func()
+
+// OperationStateCallback -called on the UI thread when background operations or transfers start or end
+var OperationStateCallback func(running bool)
+
+// JobProgressCallback -called on the UI thread while a background operation waits for a Dropbox async job
+var JobProgressCallback func(elapsed time.Duration)
+
+// ViewModeCallback -called on the UI thread when the table switches between the Dropbox folders, the trash
+// and search results
+var ViewModeCallback func()
+
+// runOperation -execute work in the background, done is called on the UI thread with the result,
+// all running operations can be aborted with CancelOperation
+func runOperation(work func(ctx context.Context) error, done func(err error)) {
+	if operationCtx == nil {
+		operationCtx, cancelOperation = context.WithCancel(context.Background())
+	}
+	ctx := operationCtx
+	runningOperations++
+	notifyOperationState()
+	go func() {
+		err := work(ctx)
+		unison.InvokeTask(func() {
+			runningOperations--
+			if runningOperations == 0 {
+				cancelOperation()
+				operationCtx, cancelOperation = nil, nil
+				notifyOperationState()
+			}
+			done(err)
+		})
+	}()
+}
+
+// CancelOperation -abort all running background operations and transfers
+func CancelOperation() {
+	if cancelOperation != nil {
+		cancelOperation()
+		operationCtx = nil // operations started from now on get a fresh context
+	}
+	if transferQueue != nil {
+		transferQueue.Cancel()
+	}
+}
+
+// IsOperationRunning -check for running background operations or transfers
+func IsOperationRunning() bool {
+	return runningOperations > 0 || TransfersBusy()
+}
+
+func notifyOperationState() {
+	if OperationStateCallback != nil {
+		OperationStateCallback(IsOperationRunning())
+	}
+}
+
+func notifyViewMode() {
+	if ViewModeCallback != nil {
+		ViewModeCallback()
+	}
+}
+
+// jobProgress -report the progress of an async job from a background operation
+func jobProgress(_ int, elapsed time.Duration) {
+	unison.InvokeTask(func() {
+		if JobProgressCallback != nil {
+			JobProgressCallback(elapsed)
+		}
+	})
+}
+
+// CallContext -context for short calls made on the UI thread, cancel it when the call returns
+func CallContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), callTimeout)
+}
+
+// OpenTransferQueue -create the transfer queue kept in file and start the transfers left from the last run,
+// client runs up to workers transfers at a time
+func OpenTransferQueue(client *api.Client, file string, workers int) {
+	var err error
+	if transferQueue, err = transfer.NewManager(client, workers, file); err != nil {
+		errs.Log(err)
+	}
+	transferQueue.ProgressCallback = func(progress transfer.ProgressType) {
+		unison.InvokeTask(func() {
+			if TransferProgressCallback != nil {
+				TransferProgressCallback(progress)
+			}
+		})
+	}
+	transferQueue.TaskDoneCallback = func(task transfer.TaskType) {
+		unison.InvokeTask(func() { transferDone(task) })
+	}
+	transferQueue.ChangedCallback = func() {
+		unison.InvokeTask(func() {
+			notifyOperationState()
+			if TransfersChangedCallback != nil {
+				TransfersChangedCallback()
+			}
+		})
+	}
+	transferQueue.IdleCallback = func(progress transfer.ProgressType) {
+		unison.InvokeTask(func() { transfersIdle(progress) })
+	}
+	transferQueue.Start()
+}
+
+// TransferQueue -queue of uploads and downloads
+func TransferQueue() *transfer.ManagerType {
+	return transferQueue
+}
+
+// TransfersBusy -check for running or queued transfers
+func TransfersBusy() bool {
+	return transferQueue != nil && transferQueue.Busy()
+}
+
+// SuspendTransfers -stop the transfers before the application quits, they continue at the next start
+func SuspendTransfers() {
+	if transferQueue != nil {
+		transferQueue.Suspend()
+	}
+}
+
+func transferDone(task transfer.TaskType) {
+	if task.Kind == transfer.Upload && task.Metadata != nil {
+		insertUploadedRow(*task.Metadata)
+		sync()
+	}
+}
+
+// transfersIdle -list the failed transfers, the tree is read again only if all of them failed because their
+// Dropbox item has gone
+func transfersIdle(progress transfer.ProgressType) {
+	var failures []error
+	notFound := true
+	if progress.FilesFailed > 0 {
+		for _, task := range transferQueue.Tasks() {
+			if task.State == transfer.Failed && task.Err != nil {
+				failures = append(failures, fmt.Errorf("%s: %w", task.Name(), task.Err))
+				notFound = notFound && errors.Is(task.Err, api.ErrNotFound)
+			}
+		}
+	}
+	if TransfersIdleCallback != nil {
+		TransfersIdleCallback()
+	}
+	if len(failures) > 0 {
+		dialogs.DialogToDisplaySystemError(assets.ErrorTransfers, errors.Join(failures...))
+		if notFound {
+			DropboxRefreshData()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Data model - flat view of search results
+// ---------------------------------------------------------------------------------------------------------------------
+
+package models
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/dialogs"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/richardwilkes/toolbox/tid"
+	"path"
+	"strings"
+)
+
+const maxSearchMatches = 1000
+
+var searchMode bool // the table lists search results instead of the Dropbox folders
+
+// SearchDoneCallback -called with the number of matches when the search results are listed
+var SearchDoneCallback func(matches int)
+
+// SearchMode -check whether the table lists search results
+func SearchMode() bool {
+	return searchMode
+}
+
+// DropboxSearch -search Dropbox and list the matches as flat rows, the path tells where they are
+func DropboxSearch(query string, options api.SearchOptionsType) {
+	var matches []*api.FileItemType
+	runOperation(func(ctx context.Context) error {
+		var err error
+		matches, err = dbxClient.Search(ctx, query, options, maxSearchMatches)
+		return err
+	}, func(err error) {
+		if err != nil {
+			DisplayDropboxError(assets.ErrorSearching, err)
+			return
+		}
+		searchMode, trashMode = true, false
+		notifyViewMode()
+		var rows []*fileSystemRow
+		for _, match := range matches {
+			rows = append(rows, newFileSystemRow(tid.MustNewTID('a'), *match, nil))
+		}
+		fileSystemTable.SetRootRows(rows)
+		sync()
+		if SearchDoneCallback != nil {
+			SearchDoneCallback(len(matches))
+		}
+	})
+}
+
+// CloseSearch -list the Dropbox folders again
+func CloseSearch() {
+	if searchMode {
+		searchMode = false
+		notifyViewMode()
+		DropboxRefreshData()
+	}
+}
+
+// RevealSearchResult -leave the search results and open the folders down to the selected row
+func RevealSearchResult() {
+	var found *fileSystemRow
+	selected := fileSystemTable.SelectedRows(true)
+	if !searchMode || len(selected) != 1 {
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorNoItemSelected, "")
+		return
+	}
+	target := strings.ToLower(selected[0].M.Path)
+	searchMode = false
+	notifyViewMode()
+	DropboxRefreshData()
+	for rows := fileSystemTable.RootRows(); rows != nil; {
+		var next *fileSystemRow
+		for _, row := range rows {
+			p := strings.ToLower(row.M.Path)
+			if p == target || strings.HasPrefix(target, p+api.DbxPathSeparator) {
+				next = row
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		found, rows = next, nil
+		if strings.ToLower(next.M.Path) != target && next.M.IsFolder {
+			next.SetOpen(true)
+			rows = next.children
+		}
+	}
+	if found != nil {
+		index := fileSystemTable.RowToIndex(found)
+		fileSystemTable.SelectByIndex(index)
+		fileSystemTable.ScrollRowIntoView(index)
+	}
+}
+
+// DropboxMoveSearchResults -move the selected search results into folder, the rows show where they went
+func DropboxMoveSearchResults(folder string) {
+	var entries []api.RelocationPathType
+	selected := fileSystemTable.SelectedRows(true)
+	if len(selected) == 0 {
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorNoItemSelected, "")
+		return
+	}
+	for _, row := range selected {
+		entries = append(entries, api.RelocationPathType{FromPath: row.M.Path, ToPath: path.Join(folder, row.M.Name)})
+	}
+	moved := make([]*api.FileItemType, len(selected))
+	var failures []error // entries of a batch that could not be moved
+	runOperation(func(ctx context.Context) error {
+		if len(entries) == 1 {
+			metadata, err := dbxClient.MoveFiles(ctx, entries[0].FromPath, entries[0].ToPath)
+			if err == nil {
+				moved[0] = &metadata.Metadata
+			}
+			return err
+		}
+		result, err := dbxClient.BatchMoveFiles(ctx, entries, jobProgress)
+		if err != nil {
+			return err
+		}
+		// the entries follow the order of the request, surplus entries are ignored
+		for i, entry := range result.Entries[:min(len(entries), len(result.Entries))] {
+			if e := entry.Err(); e != nil {
+				failures = append(failures, fmt.Errorf("%s: %w", entries[i].FromPath, e))
+			} else {
+				moved[i] = &entry.Success
+			}
+		}
+		return nil
+	}, func(err error) {
+		for i, metadata := range moved {
+			if metadata != nil {
+				selected[i].M.Path = metadata.PathDisplay
+				selected[i].M.Name = metadata.Name
+			}
+		}
+		sync()
+		if err != nil {
+			DisplayDropboxError(assets.ErrorMoving, err)
+		} else if len(failures) > 0 {
+			dialogs.DialogToDisplaySystemError(assets.ErrorMoving, errors.Join(failures...))
+		}
+	})
+}
@@ -0,0 +1,170 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Data model - trash view of deleted files and folders
+// ---------------------------------------------------------------------------------------------------------------------
+
+package models
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/dialogs"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/richardwilkes/toolbox/tid"
+	"slices"
+	"strings"
+)
+
+var trashMode bool       // the table lists deleted entries instead of the Dropbox folders
+var permanentDelete bool // the account may delete permanently
+
+// SetTrashMode -switch the table between the Dropbox folders and the deleted entries, deleting permanently
+// is offered once the account has been checked in the background
+func SetTrashMode(on bool) {
+	trashMode, searchMode, permanentDelete = on, false, false
+	notifyViewMode()
+	DropboxRefreshData()
+	if !on {
+		return
+	}
+	var userinfo *api.UserInfoType
+	runOperation(func(ctx context.Context) error {
+		var err error
+		userinfo, err = dbxClient.GetCurrentUser(ctx)
+		return err
+	}, func(err error) {
+		if err == nil && trashMode {
+			permanentDelete = api.CanDeletePermanently(userinfo)
+			notifyViewMode()
+		}
+	})
+}
+
+// TrashMode -check whether the table lists deleted entries
+func TrashMode() bool {
+	return trashMode
+}
+
+// CanDeletePermanently -check whether the deleted entries listed can be deleted beyond recovery
+func CanDeletePermanently() bool {
+	return trashMode && permanentDelete
+}
+
+// dropboxReadTrash -list the deleted entries of the whole Dropbox as flat rows, the path tells where they were
+func dropboxReadTrash() {
+	var entries []*api.FileItemType
+	runOperation(func(ctx context.Context) error {
+		var err error
+		entries, err = dbxClient.ListDeleted(ctx, "", 2000)
+		return err
+	}, func(err error) {
+		if err != nil {
+			DisplayDropboxError(assets.TxtDropboxError, err)
+			return
+		}
+		if !trashMode {
+			return // switched back while listing
+		}
+		var rows []*fileSystemRow
+		for _, entry := range entries {
+			rows = append(rows, newFileSystemRow(tid.MustNewTID('a'), *entry, nil))
+		}
+		fileSystemTable.SetRootRows(rows)
+		sync()
+	})
+}
+
+// trashRowsBelow -the selected deleted rows and the deleted rows below them
+func trashRowsBelow(selected []*fileSystemRow) []*fileSystemRow {
+	var rows []*fileSystemRow
+	for _, row := range fileSystemTable.RootRows() {
+		if slices.ContainsFunc(selected, func(s *fileSystemRow) bool {
+			return row == s ||
+				strings.HasPrefix(strings.ToLower(row.M.Path), strings.ToLower(s.M.Path)+api.DbxPathSeparator)
+		}) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// DropboxRestoreFileItems -restore the selected deleted entries to their last revision, a deleted folder is
+// restored with the deleted entries below it
+func DropboxRestoreFileItems() {
+	var restored []*fileSystemRow
+	var failures []error
+	selected := fileSystemTable.SelectedRows(true)
+	if len(selected) == 0 {
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorNoFileSelected, "")
+		return
+	}
+	rows := trashRowsBelow(selected)
+	runOperation(func(ctx context.Context) error {
+		for _, row := range rows {
+			var dbxerr *api.DropboxError
+			_, err := dbxClient.RestoreDeleted(ctx, row.M.Path)
+			if errors.As(err, &dbxerr) && dbxerr.HasTag("not_file") {
+				// folders have no revisions, they are created again
+				_, err = dbxClient.EnsureFolder(ctx, row.M.Path)
+			}
+			switch {
+			case err == nil:
+				restored = append(restored, row)
+			case ctx.Err() != nil:
+				return err
+			default:
+				failures = append(failures, fmt.Errorf("%s: %w", row.M.Path, err))
+			}
+		}
+		return nil
+	}, func(err error) {
+		for _, row := range restored {
+			removeRow(row)
+		}
+		sync()
+		if err != nil {
+			DisplayDropboxError(assets.ErrorRestoring, err)
+		} else if len(failures) > 0 {
+			dialogs.DialogToDisplaySystemError(assets.ErrorRestoring, errors.Join(failures...))
+		}
+	})
+}
+
+// DropboxPermanentlyDeleteFileItems -delete the selected deleted entries beyond recovery, after asking
+func DropboxPermanentlyDeleteFileItems() {
+	var deleted []string
+	if !CanDeletePermanently() {
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorPermanentDelete, assets.TxtPermanentDeleteUnavailable)
+		return
+	}
+	selected := fileSystemTable.SelectedRows(true)
+	if len(selected) == 0 {
+		dialogs.DialogToDisplayErrorMessage(assets.ErrorNoFileSelected, "")
+		return
+	}
+	if !dialogs.DialogToConfirmPermanentDelete(len(selected)) {
+		return
+	}
+	runOperation(func(ctx context.Context) error {
+		for _, row := range selected {
+			if err := dbxClient.PermanentlyDelete(ctx, row.M.Path); err != nil {
+				return err
+			}
+			deleted = append(deleted, row.M.Path)
+		}
+		return nil
+	}, func(err error) {
+		// entries below a deleted folder are gone with it
+		for _, row := range trashRowsBelow(slices.DeleteFunc(selected, func(row *fileSystemRow) bool {
+			return !slices.Contains(deleted, row.M.Path)
+		})) {
+			removeRow(row)
+		}
+		sync()
+		if err != nil {
+			DisplayDropboxError(assets.ErrorPermanentDelete, err)
+		}
+	})
+}
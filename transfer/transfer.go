@@ -0,0 +1,519 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Transfer manager, a persistent queue of uploads and downloads running concurrently
+// ---------------------------------------------------------------------------------------------------------------------
+
+package transfer
+
+import (
+	"Dropbox_REST_Client/api"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers   = 4                      // concurrent transfers if none are configured
+	MaxWorkers       = 16                     // largest number of concurrent transfers
+	progressInterval = 250 * time.Millisecond // minimum time between two progress reports
+	saveInterval     = 2 * time.Second        // minimum time between two writes of the queue after finished tasks
+	rateSmoothing    = 0.3                    // weight of the latest sample in the transfer rate
+)
+
+type KindType int
+
+const (
+	Upload KindType = iota
+	Download
+)
+
+type StateType int
+
+const (
+	Queued StateType = iota
+	Running
+	Paused
+	Suspended // stopped when the application quit, queued again at the next start
+	Done
+	Failed
+	Cancelled
+)
+
+// TaskType -a single file transfer, the result fields are set when the task is done
+type TaskType struct {
+	Id          int64                 `json:"id"`
+	Kind        KindType              `json:"kind"`
+	OSPath      string                `json:"os_path"`
+	DbxPath     string                `json:"dbx_path"`
+	Size        int64                 `json:"size"` // expected size, replaced by the real size when the transfer reports it
+	State       StateType             `json:"state"`
+	Resume      *api.UploadResumeType `json:"resume,omitempty"` // upload session of an interrupted large upload
+	Transferred int64                 `json:"-"`
+	Metadata    *api.FileItemType     `json:"-"`
+	Skipped     bool                  `json:"-"` // existing file kept by the existing files strategy
+	Err         error                 `json:"-"`
+	cancel      context.CancelFunc
+	done        chan struct{} // closed when the goroutine of the last run has returned
+	run         int           // incremented with every start, tells a stopped run from its successor
+	failed      bool          // counted as failed in the progress since the queue was last idle
+}
+
+// Name -file name of the task for display
+func (t *TaskType) Name() string {
+	if t.Kind == Upload {
+		return filepath.Base(t.OSPath)
+	}
+	return path.Base(t.DbxPath)
+}
+
+// active -check whether the goroutine of the last run has not returned yet, a stopped run may still be
+// writing the partial file or sending to the upload session
+func (t *TaskType) active() bool {
+	if t.done == nil {
+		return false
+	}
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// ProgressType -snapshot of the progress since the queue was last idle, paused and cancelled tasks are not counted
+type ProgressType struct {
+	Files       int
+	FilesDone   int
+	FilesFailed int
+	Bytes       int64
+	BytesDone   int64
+	Rate        float64       // bytes per second
+	ETA         time.Duration // 0 if unknown
+	Elapsed     time.Duration
+	Running     []TaskType // copies of the running tasks
+}
+
+// ManagerType -runs the queued transfers with a fixed number of workers and keeps the queue in a file,
+// the callbacks are called one at a time from the worker goroutines and must not call the manager
+type ManagerType struct {
+	client  *api.Client
+	workers int
+	file    string
+	// ProgressCallback -called at most every progressInterval and when the queue becomes idle
+	ProgressCallback func(progress ProgressType)
+	// TaskDoneCallback -called with a copy of a task that has finished or failed
+	TaskDoneCallback func(task TaskType)
+	// ChangedCallback -called when tasks are added or removed or change their state
+	ChangedCallback func()
+	// IdleCallback -called when the last running task has ended and nothing is queued
+	IdleCallback func(progress ProgressType)
+
+	callbackMutex sync.Mutex // serializes the callbacks
+	mutex         sync.Mutex
+	tasks         []*TaskType
+	nextId        int64
+	running       int // started tasks whose goroutine has not returned yet
+	progress      ProgressType
+	started       time.Time
+	lastReport    time.Time
+	lastBytes     int64
+	lastSave      time.Time
+}
+
+// NewManager -transfer manager with the given number of concurrent transfers, 0 selects DefaultWorkers, the queue
+// is read from file if it exists, tasks that were queued, running or suspended are queued again, call Start to run them
+func NewManager(client *api.Client, workers int, file string) (*ManagerType, error) {
+	m := &ManagerType{client: client, workers: workerCount(workers), file: file}
+	if file == "" {
+		return m, nil
+	}
+	j, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(j, &m.tasks)
+	}
+	if err != nil {
+		return m, err
+	}
+	for _, task := range m.tasks {
+		m.nextId = max(m.nextId, task.Id)
+		switch task.State {
+		case Queued, Running, Suspended:
+			task.State = Queued
+			m.enter(task)
+		}
+	}
+	return m, nil
+}
+
+// Start -run the queued tasks
+func (m *ManagerType) Start() {
+	m.mutex.Lock()
+	m.schedule()
+	m.finish(nil)
+}
+
+// Add -append tasks to the queue and start them as workers become free
+func (m *ManagerType) Add(tasks ...*TaskType) {
+	m.mutex.Lock()
+	for _, task := range tasks {
+		m.nextId++
+		task.Id = m.nextId
+		task.State = Queued
+		m.tasks = append(m.tasks, task)
+		m.enter(task)
+	}
+	m.save(true)
+	m.schedule()
+	m.finish(nil)
+}
+
+// SetWorkers -change the number of concurrent transfers, 0 selects DefaultWorkers, with fewer workers the
+// running transfers finish before further tasks are started
+func (m *ManagerType) SetWorkers(workers int) {
+	m.mutex.Lock()
+	m.workers = workerCount(workers)
+	m.schedule()
+	m.finish(nil)
+}
+
+// Workers -number of concurrent transfers
+func (m *ManagerType) Workers() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.workers
+}
+
+// Tasks -copies of all tasks in the queue
+func (m *ManagerType) Tasks() []TaskType {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	tasks := make([]TaskType, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		tasks = append(tasks, *task)
+	}
+	return tasks
+}
+
+// Busy -check for running or queued tasks
+func (m *ManagerType) Busy() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.busy()
+}
+
+// Pause -stop queued or running tasks, all tasks if no ids are given, a resumed task continues
+// from its last committed upload chunk or the end of its partial download
+func (m *ManagerType) Pause(ids ...int64) {
+	m.stop(Paused, ids)
+}
+
+// Suspend -stop all queued and running tasks before the application quits, they are queued again at the next start
+func (m *ManagerType) Suspend() {
+	m.stop(Suspended, nil)
+}
+
+// Cancel -remove tasks from the queue, all tasks if no ids are given, running tasks are stopped
+func (m *ManagerType) Cancel(ids ...int64) {
+	m.stop(Cancelled, ids)
+}
+
+// Resume -queue paused, suspended or failed tasks again, all tasks if no ids are given
+func (m *ManagerType) Resume(ids ...int64) {
+	m.mutex.Lock()
+	for _, task := range m.selectTasks(ids) {
+		switch task.State {
+		case Paused, Suspended, Failed:
+			if task.failed {
+				// the failed task is still counted, enter counts it again
+				m.progress.Files--
+				m.progress.FilesFailed--
+				task.failed = false
+			}
+			task.State = Queued
+			task.Err = nil
+			m.enter(task)
+		}
+	}
+	m.save(true)
+	m.schedule()
+	m.finish(nil)
+}
+
+// stop -move tasks to Paused, Suspended or Cancelled
+func (m *ManagerType) stop(state StateType, ids []int64) {
+	m.mutex.Lock()
+	for _, task := range m.selectTasks(ids) {
+		switch task.State {
+		case Queued:
+			m.leave(task)
+		case Running:
+			m.leave(task)
+			task.cancel() // the goroutine removes a cancelled task when it returns
+		case Paused, Failed:
+			if state != Cancelled {
+				continue
+			}
+		default:
+			continue
+		}
+		task.State = state
+		if state == Cancelled && task.cancel == nil {
+			m.discard(task)
+		}
+	}
+	m.save(true)
+	m.finish(nil)
+}
+
+func workerCount(workers int) int {
+	if workers <= 0 {
+		return DefaultWorkers
+	}
+	return min(workers, MaxWorkers)
+}
+
+func (m *ManagerType) selectTasks(ids []int64) []*TaskType {
+	if len(ids) == 0 {
+		return slices.Clone(m.tasks)
+	}
+	var tasks []*TaskType
+	for _, task := range m.tasks {
+		if slices.Contains(ids, task.Id) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// schedule -start queued tasks while workers are free, a task resumed before its stopped run has returned
+// is started when that run returns, mutex is held
+func (m *ManagerType) schedule() {
+	for _, task := range m.tasks {
+		if m.running >= m.workers {
+			return
+		}
+		if task.State != Queued || task.active() {
+			continue
+		}
+		if m.started.IsZero() {
+			m.started = time.Now()
+			m.lastReport, m.lastBytes = m.started, m.progress.BytesDone
+		}
+		var ctx context.Context
+		ctx, task.cancel = context.WithCancel(context.Background())
+		task.State = Running
+		task.Transferred = 0
+		task.run++
+		task.done = make(chan struct{})
+		m.running++
+		go m.execute(ctx, task, task.run, task.done)
+	}
+}
+
+func (m *ManagerType) execute(ctx context.Context, task *TaskType, run int, done chan struct{}) {
+	var metadata *api.FileItemType
+	var skipped bool
+	var err error
+	progress := func(transferred, total int64) {
+		m.update(task, run, transferred, total)
+	}
+	switch task.Kind {
+	case Upload:
+		m.mutex.Lock()
+		resume := task.Resume
+		m.mutex.Unlock()
+		metadata, skipped, err = m.client.UploadLocalFileResumable(ctx, task.OSPath, task.DbxPath, resume,
+			func(state api.UploadResumeType) { m.checkpoint(task, run, state) }, progress)
+	case Download:
+		metadata, skipped, err = m.client.DownloadToFileWithStrategy(ctx, task.DbxPath, task.OSPath, progress)
+	}
+	m.mutex.Lock()
+	m.running--
+	close(done)
+	finished := task.run == run && task.State == Running
+	if task.run == run {
+		task.cancel()
+		task.cancel = nil
+		if task.State == Cancelled {
+			m.discard(task)
+		}
+	}
+	if !finished {
+		m.schedule()
+		m.finish(nil)
+		return
+	}
+	task.Metadata, task.Skipped, task.Err = metadata, skipped, err
+	if err != nil {
+		task.State = Failed
+		task.failed = true
+		m.progress.FilesFailed++
+		m.progress.Bytes -= task.Size // failed bytes no longer count for rate and ETA
+		m.progress.BytesDone -= task.Transferred
+	} else {
+		task.State = Done
+		m.progress.FilesDone++
+		m.progress.BytesDone += task.Size - task.Transferred // skipped or not reported to the end
+		m.remove(task)
+	}
+	m.schedule()
+	m.save(err != nil || !m.busy())
+	m.finish(task)
+}
+
+// update -progress of a running task, a retried request may report less than before
+func (m *ManagerType) update(task *TaskType, run int, transferred, total int64) {
+	m.mutex.Lock()
+	if task.run == run && task.State == Running {
+		if total >= 0 && total != task.Size {
+			m.progress.Bytes += total - task.Size
+			task.Size = total
+		}
+		m.progress.BytesDone += transferred - task.Transferred
+		task.Transferred = transferred
+	}
+	m.mutex.Unlock()
+	m.report()
+}
+
+// checkpoint -keep the state of the upload session of a task, the queue file is written at once,
+// a paused or suspended task still keeps the last chunk its run has committed
+func (m *ManagerType) checkpoint(task *TaskType, run int, state api.UploadResumeType) {
+	m.mutex.Lock()
+	if task.run == run && task.State != Cancelled {
+		task.Resume = &state
+		m.save(true)
+	}
+	m.mutex.Unlock()
+}
+
+// enter -count a queued task in the progress, mutex is held
+func (m *ManagerType) enter(task *TaskType) {
+	m.progress.Files++
+	m.progress.Bytes += task.Size
+}
+
+// leave -remove a queued or running task from the progress, mutex is held
+func (m *ManagerType) leave(task *TaskType) {
+	m.progress.Files--
+	m.progress.Bytes -= task.Size
+	m.progress.BytesDone -= task.Transferred
+}
+
+func (m *ManagerType) remove(task *TaskType) {
+	m.tasks = slices.DeleteFunc(m.tasks, func(t *TaskType) bool { return t == task })
+}
+
+// discard -remove a cancelled task together with the partial file of an interrupted download, mutex is held
+func (m *ManagerType) discard(task *TaskType) {
+	if task.Kind == Download {
+		api.DiscardPartialDownload(task.OSPath)
+	}
+	m.remove(task)
+}
+
+func (m *ManagerType) busy() bool {
+	return slices.ContainsFunc(m.tasks, func(t *TaskType) bool { return t.State == Queued || t.State == Running })
+}
+
+// save -write the unfinished tasks to the queue file, unless forced at most every saveInterval, mutex is held
+func (m *ManagerType) save(force bool) {
+	if m.file == "" || (!force && time.Since(m.lastSave) < saveInterval) {
+		return
+	}
+	j, err := json.Marshal(m.tasks)
+	if err != nil {
+		return
+	}
+	tmp := m.file + ".tmp"
+	if os.WriteFile(tmp, j, 0644) == nil && os.Rename(tmp, m.file) == nil {
+		m.lastSave = time.Now()
+	}
+}
+
+// finish -release the mutex after a change of the queue and notify the callbacks, done is a task that has ended,
+// when the queue becomes idle the final progress is reported and the next task starts a new count
+func (m *ManagerType) finish(done *TaskType) {
+	var progress ProgressType
+	var task TaskType
+	idle := m.running == 0 && !m.busy() && !m.started.IsZero()
+	if idle {
+		progress = m.snapshot(time.Now())
+		m.progress = ProgressType{}
+		m.started = time.Time{}
+		for _, task := range m.tasks {
+			task.failed = false
+		}
+	}
+	if done != nil {
+		task = *done
+	}
+	m.callbackMutex.Lock()
+	m.mutex.Unlock()
+	if m.ChangedCallback != nil {
+		m.ChangedCallback()
+	}
+	if done != nil && m.TaskDoneCallback != nil {
+		m.TaskDoneCallback(task)
+	}
+	if idle && m.ProgressCallback != nil {
+		m.ProgressCallback(progress)
+	}
+	if idle && m.IdleCallback != nil {
+		m.IdleCallback(progress)
+	}
+	m.callbackMutex.Unlock()
+	if !idle {
+		m.report()
+	}
+}
+
+// report -send a progress snapshot, unless the last one is too recent
+func (m *ManagerType) report() {
+	m.mutex.Lock()
+	now := time.Now()
+	if m.ProgressCallback == nil || m.started.IsZero() || now.Sub(m.lastReport) < progressInterval {
+		m.mutex.Unlock()
+		return
+	}
+	progress := m.snapshot(now)
+	m.callbackMutex.Lock() // taken before the state is released, snapshots are delivered in order
+	m.mutex.Unlock()
+	m.ProgressCallback(progress)
+	m.callbackMutex.Unlock()
+}
+
+// snapshot -current progress, updates the transfer rate, mutex is held
+func (m *ManagerType) snapshot(now time.Time) ProgressType {
+	if elapsed := now.Sub(m.lastReport); elapsed > 0 {
+		sample := float64(m.progress.BytesDone-m.lastBytes) / elapsed.Seconds()
+		if m.progress.Rate == 0 {
+			m.progress.Rate = max(sample, 0)
+		} else {
+			m.progress.Rate = max(rateSmoothing*sample+(1-rateSmoothing)*m.progress.Rate, 0)
+		}
+	}
+	m.lastReport, m.lastBytes = now, m.progress.BytesDone
+	progress := m.progress
+	progress.Elapsed = now.Sub(m.started)
+	if progress.Rate > 0 {
+		progress.ETA = time.Duration(float64(progress.Bytes-progress.BytesDone) / progress.Rate * float64(time.Second))
+	}
+	progress.Running = make([]TaskType, 0, m.running)
+	for _, task := range m.tasks {
+		if task.State == Running {
+			progress.Running = append(progress.Running, *task)
+		}
+	}
+	return progress
+}
@@ -0,0 +1,289 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Transfer manager tests against the stand-in Dropbox server
+// ---------------------------------------------------------------------------------------------------------------------
+
+package transfer_test
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/api/dbxtest"
+	"Dropbox_REST_Client/transfer"
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	endpointDownload = "/2/files/download"
+	waitTimeOut      = 10 * time.Second
+)
+
+// gateTransport -holds downloads of paths containing hold until they are let through, counts the downloads
+// waiting at the gate
+type gateTransport struct {
+	base    http.RoundTripper
+	hold    string
+	mutex   sync.Mutex
+	open    chan struct{}
+	waiting int
+	most    int // largest number of downloads waiting at the same time
+}
+
+func newGateTransport(base http.RoundTripper, hold string) *gateTransport {
+	return &gateTransport{base: base, hold: hold, open: make(chan struct{})}
+}
+
+func (g *gateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != endpointDownload || !strings.Contains(req.Header.Get("Dropbox-API-Arg"), g.hold) {
+		return g.base.RoundTrip(req)
+	}
+	g.mutex.Lock()
+	g.waiting++
+	g.most = max(g.most, g.waiting)
+	g.mutex.Unlock()
+	defer func() {
+		g.mutex.Lock()
+		g.waiting--
+		g.mutex.Unlock()
+	}()
+	select {
+	case <-g.open:
+		return g.base.RoundTrip(req)
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+// wait -until n downloads are waiting at the gate
+func (g *gateTransport) wait(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeOut)
+	for {
+		g.mutex.Lock()
+		waiting := g.waiting
+		g.mutex.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d downloads waiting, want %d", waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newTestManager -stand-in server and a manager keeping its queue in file, the progress of every idle queue is sent
+// to the returned channel
+func newTestManager(t *testing.T, workers int, file string) (*dbxtest.Server, *api.Client, *transfer.ManagerType,
+	chan transfer.ProgressType) {
+	t.Helper()
+	s := dbxtest.NewServer()
+	t.Cleanup(s.Close)
+	c := s.NewClient()
+	c.SetRetryPolicy(api.RetryPolicyType{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+	m, err := transfer.NewManager(c, workers, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle := make(chan transfer.ProgressType, 10)
+	m.IdleCallback = func(progress transfer.ProgressType) { idle <- progress }
+	return s, c, m, idle
+}
+
+// waitIdle -progress of the next idle queue
+func waitIdle(t *testing.T, idle chan transfer.ProgressType) transfer.ProgressType {
+	t.Helper()
+	select {
+	case progress := <-idle:
+		return progress
+	case <-time.After(waitTimeOut):
+		t.Fatal("queue did not become idle")
+		return transfer.ProgressType{}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	tests := []struct {
+		workers int
+		want    int
+	}{
+		{0, transfer.DefaultWorkers},
+		{-1, transfer.DefaultWorkers},
+		{1, 1},
+		{transfer.MaxWorkers, transfer.MaxWorkers},
+		{transfer.MaxWorkers + 1, transfer.MaxWorkers},
+	}
+	for _, tt := range tests {
+		m, err := transfer.NewManager(nil, tt.workers, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Workers(); got != tt.want {
+			t.Errorf("NewManager(%d).Workers() = %d, want %d", tt.workers, got, tt.want)
+		}
+		m.SetWorkers(tt.workers)
+		if got := m.Workers(); got != tt.want {
+			t.Errorf("SetWorkers(%d), Workers() = %d, want %d", tt.workers, got, tt.want)
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	remote := []byte("remote content")
+	local := []byte("local content")
+	tests := []struct {
+		name        string
+		kind        transfer.KindType
+		remote      []byte // nil: no remote file
+		local       []byte // nil: no local file
+		wantRemote  []byte
+		wantLocal   []byte
+		wantSkipped bool
+		wantFailed  bool
+	}{
+		{"upload", transfer.Upload, nil, local, local, local, false, false},
+		{"identical upload skipped", transfer.Upload, local, local, local, local, true, false},
+		{"download", transfer.Download, remote, nil, remote, remote, false, false},
+		{"identical download skipped", transfer.Download, remote, remote, remote, remote, true, false},
+		{"download of a missing file fails", transfer.Download, nil, nil, nil, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, m, idle := newTestManager(t, 0, "")
+			var done []transfer.TaskType
+			m.TaskDoneCallback = func(task transfer.TaskType) { done = append(done, task) }
+			if tt.remote != nil {
+				s.AddFile("/file.txt", tt.remote)
+			}
+			osPath := filepath.Join(t.TempDir(), "file.txt")
+			if tt.local != nil {
+				if err := os.WriteFile(osPath, tt.local, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m.Add(&transfer.TaskType{Kind: tt.kind, OSPath: osPath, DbxPath: "/file.txt"})
+			progress := waitIdle(t, idle)
+			wantDone, wantFailed := 1, 0
+			if tt.wantFailed {
+				wantDone, wantFailed = 0, 1
+			}
+			if progress.Files != 1 || progress.FilesDone != wantDone || progress.FilesFailed != wantFailed {
+				t.Errorf("progress = %d files, %d done, %d failed, want 1, %d, %d", progress.Files,
+					progress.FilesDone, progress.FilesFailed, wantDone, wantFailed)
+			}
+			if len(done) != 1 {
+				t.Fatalf("%d tasks reported done, want 1", len(done))
+			}
+			if done[0].Skipped != tt.wantSkipped || (done[0].Err != nil) != tt.wantFailed {
+				t.Errorf("task skipped %v, error %v, want skipped %v, failed %v", done[0].Skipped, done[0].Err,
+					tt.wantSkipped, tt.wantFailed)
+			}
+			if tasks := m.Tasks(); tt.wantFailed != (len(tasks) == 1 && tasks[0].State == transfer.Failed) {
+				t.Errorf("queue = %+v, want only failed tasks kept", tasks)
+			}
+			if got, _ := s.Content("/file.txt"); !bytes.Equal(got, tt.wantRemote) {
+				t.Errorf("remote = %q, want %q", got, tt.wantRemote)
+			}
+			if got, _ := os.ReadFile(osPath); !bytes.Equal(got, tt.wantLocal) {
+				t.Errorf("local = %q, want %q", got, tt.wantLocal)
+			}
+		})
+	}
+}
+
+func TestManagerResumeFailed(t *testing.T) {
+	s, c, m, idle := newTestManager(t, 2, "")
+	gate := newGateTransport(s.Client().Transport, "/slow.txt")
+	c.SetHTTPClient(&http.Client{Transport: gate})
+	failed := make(chan transfer.TaskType, 1)
+	m.TaskDoneCallback = func(task transfer.TaskType) {
+		if task.Err != nil {
+			failed <- task
+		}
+	}
+	s.AddFile("/slow.txt", []byte("slow"))
+	dir := t.TempDir()
+	m.Add(&transfer.TaskType{Kind: transfer.Download, OSPath: filepath.Join(dir, "slow.txt"), DbxPath: "/slow.txt"},
+		&transfer.TaskType{Kind: transfer.Download, OSPath: filepath.Join(dir, "late.txt"), DbxPath: "/late.txt"})
+	var task transfer.TaskType
+	select {
+	case task = <-failed:
+	case <-time.After(waitTimeOut):
+		t.Fatal("download of the missing file did not fail")
+	}
+	// resumed while the queue is still busy, the failed run must not be counted twice
+	s.AddFile("/late.txt", []byte("late"))
+	m.Resume(task.Id)
+	close(gate.open)
+	progress := waitIdle(t, idle)
+	if progress.Files != 2 || progress.FilesDone != 2 || progress.FilesFailed != 0 {
+		t.Errorf("progress = %d files, %d done, %d failed, want 2, 2, 0", progress.Files, progress.FilesDone,
+			progress.FilesFailed)
+	}
+	if tasks := m.Tasks(); len(tasks) != 0 {
+		t.Errorf("queue = %+v, want empty", tasks)
+	}
+}
+
+func TestManagerSetWorkers(t *testing.T) {
+	const tasks = 5
+	s, c, m, idle := newTestManager(t, 2, "")
+	gate := newGateTransport(s.Client().Transport, "")
+	c.SetHTTPClient(&http.Client{Transport: gate})
+	dir := t.TempDir()
+	for i := range tasks {
+		name := string(rune('a'+i)) + ".txt"
+		s.AddFile("/"+name, []byte(name))
+		m.Add(&transfer.TaskType{Kind: transfer.Download, OSPath: filepath.Join(dir, name), DbxPath: "/" + name})
+	}
+	gate.wait(t, 2)
+	m.SetWorkers(3)
+	gate.wait(t, 3)
+	close(gate.open)
+	progress := waitIdle(t, idle)
+	if progress.FilesDone != tasks {
+		t.Errorf("%d files done, want %d", progress.FilesDone, tasks)
+	}
+	if gate.most != 3 {
+		t.Errorf("at most %d concurrent downloads, want 3", gate.most)
+	}
+}
+
+func TestManagerQueueFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.json")
+	s, c, m, idle := newTestManager(t, 0, file)
+	gate := newGateTransport(s.Client().Transport, "")
+	c.SetHTTPClient(&http.Client{Transport: gate})
+	s.AddFile("/file.txt", []byte("content"))
+	osPath := filepath.Join(t.TempDir(), "file.txt")
+	m.Add(&transfer.TaskType{Kind: transfer.Download, OSPath: osPath, DbxPath: "/file.txt"})
+	gate.wait(t, 1)
+	m.Suspend()
+	waitIdle(t, idle)
+	if _, err := os.Stat(osPath); err == nil {
+		t.Fatal("suspended download has been completed")
+	}
+	// the next start reads the queue and runs the suspended task again
+	next, err := transfer.NewManager(s.NewClient(), 0, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextIdle := make(chan transfer.ProgressType, 1)
+	next.IdleCallback = func(progress transfer.ProgressType) { nextIdle <- progress }
+	if tasks := next.Tasks(); len(tasks) != 1 || tasks[0].State != transfer.Queued || tasks[0].OSPath != osPath {
+		t.Fatalf("queue read = %+v, want the suspended task queued", tasks)
+	}
+	next.Start()
+	if progress := waitIdle(t, nextIdle); progress.FilesDone != 1 {
+		t.Errorf("%d files done, want 1", progress.FilesDone)
+	}
+	if got, _ := os.ReadFile(osPath); string(got) != "content" {
+		t.Errorf("local = %q, want %q", got, "content")
+	}
+}
@@ -7,21 +7,40 @@ package ui
 
 import (
 	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/assets"
 	"Dropbox_REST_Client/dialogs"
 	"Dropbox_REST_Client/models"
-	"fmt"
 	"github.com/richardwilkes/unison"
 	"os"
 )
 
 func aboutUser() {
-	userinfo, err := api.GetCurrentUser()
-	if err == nil {
-		dialogs.AboutUserDialog(userinfo)
+	ctx, cancel := models.CallContext()
+	defer cancel()
+	userinfo, err := dbxClient.GetCurrentUser(ctx)
+	if err != nil {
+		models.DisplayDropboxError(assets.TxtDropboxError, err)
+		return
+	}
+	dialogs.AboutUserDialog(dbxClient, userinfo)
+}
+
+func cancelOperation() {
+	models.CancelOperation()
+}
+
+func pruneHashCache() {
+	hashCache.Prune()
+	if err := hashCache.Save(); err != nil {
+		dialogs.DialogToDisplaySystemError(assets.ErrorWritingHashCache, err)
 	}
 }
 
 func refresh() {
+	if models.SearchMode() {
+		search() // the results are searched again
+		return
+	}
 	models.DropboxRefreshData()
 }
 
@@ -34,12 +53,31 @@ func newFolder() {
 }
 
 func deleteItem() {
+	if models.TrashMode() {
+		models.DropboxPermanentlyDeleteFileItems()
+		return
+	}
 	models.DropboxDeleteFileItems()
 }
 
+func restoreItems() {
+	models.DropboxRestoreFileItems()
+}
+
+func toggleTrash() {
+	models.SetTrashMode(!models.TrashMode())
+}
+
+func versionHistory() {
+	models.DropboxVersionHistory()
+}
+
 func uploadItems() {
 	var allFolders, allFiles []*api.FileSysStructureType
 	var err error
+	if !models.CheckUploadTarget() {
+		return
+	}
 	homeDir, _ := os.UserHomeDir()
 	dialog := unison.NewOpenDialog()
 	dialog.SetInitialDirectory(homeDir)
@@ -51,24 +89,22 @@ func uploadItems() {
 	if dialog.RunModal() {
 		allFolders, allFiles, err = api.ListLocalFileStructure(dialog.Paths())
 		if err != nil {
-			fmt.Println(err)
+			dialogs.DialogToDisplaySystemError(assets.ErrorReadError, err)
 			return
 		}
-	}
-	// TEST
-	for i, folder := range allFolders {
-		fmt.Println(i, folder.DbxPath)
-	}
-	for j, file := range allFiles {
-		fmt.Println(j, file.DbxPath+file.FileName)
+		models.DropboxUploadItems(allFolders, allFiles)
 	}
 }
 
 func downloadItems() {
-	// TEST
-	filename := "/Users/jan/Downloads/milky-way-nasa.jpg"
-	content, _ := os.ReadFile(filename)
-	fmt.Println(len(content))
-	result := api.ConputeHash(content)
-	fmt.Println(result)
+	homeDir, _ := os.UserHomeDir()
+	dialog := unison.NewOpenDialog()
+	dialog.SetInitialDirectory(homeDir)
+	dialog.SetAllowsMultipleSelection(false)
+	dialog.SetCanChooseDirectories(true)
+	dialog.SetCanChooseFiles(false)
+	dialog.SetResolvesAliases(true)
+	if dialog.RunModal() && len(dialog.Paths()) == 1 {
+		models.DropboxDownloadFileItems(dialog.Paths()[0])
+	}
 }
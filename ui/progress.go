@@ -0,0 +1,95 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Transfer progress panel, using Unison library (c) Richard A. Wilkes
+// https://github.com/richardwilkes/unison
+// ---------------------------------------------------------------------------------------------------------------------
+
+package ui
+
+import (
+	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/models"
+	"Dropbox_REST_Client/transfer"
+	"fmt"
+	"github.com/richardwilkes/unison"
+	"github.com/richardwilkes/unison/enums/align"
+	"strings"
+	"time"
+)
+
+const progressBarMaximum float32 = 1000
+const maxRunningNames = 4 // number of running transfers listed by name
+
+var progressBar *unison.ProgressBar
+var lblProgress *unison.Label
+var lblRunning *unison.Label
+
+func createProgressPanel() *unison.Panel {
+	panel := unison.NewPanel()
+	panel.SetLayout(&unison.FlexLayout{
+		Columns:  2,
+		HSpacing: 10,
+		VSpacing: 2,
+	})
+	panel.SetLayoutData(&unison.FlexLayoutData{
+		HAlign: align.Fill,
+		HGrab:  true,
+	})
+	progressBar = unison.NewProgressBar(progressBarMaximum)
+	progressBar.SetLayoutData(&unison.FlexLayoutData{
+		HAlign: align.Fill,
+		VAlign: align.Middle,
+		HGrab:  true,
+	})
+	panel.AddChild(progressBar)
+	lblProgress = unison.NewLabel()
+	lblProgress.Font = unison.LabelFont.Face().Font(toolbarFontSize)
+	lblProgress.SetTitle(assets.TxtTransferIdle)
+	panel.AddChild(lblProgress)
+	lblRunning = unison.NewLabel()
+	lblRunning.Font = unison.LabelFont.Face().Font(toolbarFontSize)
+	lblRunning.SetLayoutData(&unison.FlexLayoutData{
+		HSpan:  2,
+		HAlign: align.Fill,
+		HGrab:  true,
+	})
+	panel.AddChild(lblRunning)
+	models.TransferProgressCallback = updateProgressPanel
+	return panel
+}
+
+func updateProgressPanel(progress transfer.ProgressType) {
+	var names []string
+	if progress.Bytes > 0 {
+		progressBar.SetCurrent(progressBarMaximum * float32(progress.BytesDone) / float32(progress.Bytes))
+	} else if progress.Files > 0 {
+		progressBar.SetCurrent(progressBarMaximum * float32(progress.FilesDone+progress.FilesFailed) /
+			float32(progress.Files))
+	}
+	text := fmt.Sprintf(assets.TxtTransferProgress, progress.FilesDone, progress.Files,
+		models.ConvertBytes(progress.BytesDone), models.ConvertBytes(progress.Bytes))
+	if progress.FilesFailed > 0 {
+		text += fmt.Sprintf(assets.TxtTransferFailed, progress.FilesFailed)
+	}
+	if len(progress.Running) > 0 && progress.Rate > 0 {
+		text += fmt.Sprintf(assets.TxtTransferRate, models.ConvertBytes(int64(progress.Rate)),
+			progress.ETA.Round(time.Second))
+	}
+	lblProgress.SetTitle(text)
+	for i, running := range progress.Running {
+		if i == maxRunningNames {
+			names = append(names, "…")
+			break
+		}
+		names = append(names, running.Name())
+	}
+	lblRunning.SetTitle(strings.Join(names, ", "))
+	lblProgress.Parent().MarkForLayoutAndRedraw()
+}
+
+// updateJobProgress -show how long a background operation has been waiting for Dropbox
+func updateJobProgress(elapsed time.Duration) {
+	if !models.TransfersBusy() {
+		lblRunning.SetTitle(fmt.Sprintf(assets.TxtJobProgress, elapsed.Round(time.Second)))
+	}
+}
@@ -0,0 +1,129 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Search field and search results
+// ---------------------------------------------------------------------------------------------------------------------
+
+package ui
+
+import (
+	"Dropbox_REST_Client/api"
+	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/dialogs"
+	"Dropbox_REST_Client/models"
+	"fmt"
+	"github.com/richardwilkes/unison"
+	"github.com/richardwilkes/unison/enums/align"
+	"github.com/richardwilkes/unison/enums/check"
+	"strings"
+)
+
+const (
+	searchFieldWidth float32 = 200
+	searchExtension          = "ext:" // query token restricting the file extension, e.g. ext:pdf
+	searchScope              = "in:"  // query token restricting the folder, e.g. in:/Photos
+)
+
+// searchCategories -api categories of the kinds offered, in the order of the popup
+var searchCategories = []struct {
+	option   string
+	category string
+}{
+	{assets.OptAllCategories, ""},
+	{assets.OptImages, api.DbxCategoryImage},
+	{assets.OptDocuments, api.DbxCategoryDocument},
+	{assets.OptPdfs, api.DbxCategoryPdf},
+	{assets.OptSpreadsheets, api.DbxCategorySpreadsheet},
+	{assets.OptPresentations, api.DbxCategoryPresentation},
+	{assets.OptAudio, api.DbxCategoryAudio},
+	{assets.OptVideos, api.DbxCategoryVideo},
+	{assets.OptFolders, api.DbxCategoryFolder},
+}
+
+var searchField *unison.Field
+var popCategory *unison.PopupMenu[string]
+var chkNamesOnly *unison.CheckBox
+
+// addSearchControls -search field, kind of entries and names only switch, Return searches, an empty field
+// lists the folders again
+func addSearchControls(panel *unison.Panel) {
+	font := unison.LabelFont.Face().Font(toolbarFontSize)
+	searchField = unison.NewField()
+	searchField.Font = font
+	searchField.Watermark = assets.TxtSearchHint
+	searchField.MinimumTextWidth = searchFieldWidth
+	searchField.SetLayoutData(align.Middle)
+	searchField.KeyDownCallback = func(keyCode unison.KeyCode, mod unison.Modifiers, repeat bool) bool {
+		switch keyCode {
+		case unison.KeyReturn, unison.KeyNumPadEnter:
+			search()
+			return true
+		case unison.KeyEscape:
+			searchField.SetText("")
+			models.CloseSearch()
+			return true
+		}
+		return searchField.DefaultKeyDown(keyCode, mod, repeat)
+	}
+	panel.AddChild(searchField)
+	createSpacer(5, panel)
+	popCategory = unison.NewPopupMenu[string]()
+	popCategory.Font = font
+	for _, c := range searchCategories {
+		popCategory.AddItem(c.option)
+	}
+	popCategory.SetFocusable(false)
+	popCategory.SelectIndex(0)
+	panel.AddChild(popCategory)
+	createSpacer(5, panel)
+	chkNamesOnly = unison.NewCheckBox()
+	chkNamesOnly.Font = font
+	chkNamesOnly.SetTitle(assets.CapNamesOnly)
+	chkNamesOnly.SetFocusable(false)
+	chkNamesOnly.SetLayoutData(align.Middle)
+	panel.AddChild(chkNamesOnly)
+}
+
+// parseSearch -split the text of the search field into the query and the ext: and in: options
+func parseSearch(text string) (string, api.SearchOptionsType) {
+	var words []string
+	var options api.SearchOptionsType
+	for _, word := range strings.Fields(text) {
+		switch {
+		case strings.HasPrefix(word, searchExtension) && len(word) > len(searchExtension):
+			options.FileExtensions = append(options.FileExtensions,
+				strings.TrimPrefix(strings.TrimPrefix(word, searchExtension), "."))
+		case strings.HasPrefix(word, searchScope+api.DbxPathSeparator):
+			options.Path = strings.TrimSuffix(strings.TrimPrefix(word, searchScope), api.DbxPathSeparator)
+		default:
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " "), options
+}
+
+func search() {
+	query, options := parseSearch(searchField.Text())
+	if query == "" {
+		models.CloseSearch()
+		return
+	}
+	if i := popCategory.SelectedIndex(); i > 0 {
+		options.FileCategories = []api.TagType{{Tag: searchCategories[i].category}}
+	}
+	options.FilenameOnly = chkNamesOnly.State == check.On
+	models.DropboxSearch(query, options)
+}
+
+func searchDone(matches int) {
+	lblRunning.SetTitle(fmt.Sprintf(assets.TxtSearchMatches, matches))
+}
+
+func revealSearchResult() {
+	models.RevealSearchResult()
+}
+
+func moveSearchResults() {
+	if folder := dialogs.DialogToQueryMoveTarget(); folder != "" {
+		models.DropboxMoveSearchResults(folder)
+	}
+}
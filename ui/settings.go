@@ -8,6 +8,7 @@ package ui
 import (
 	"Dropbox_REST_Client/api"
 	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/models"
 	"encoding/json"
 	"github.com/richardwilkes/unison"
 	"io"
@@ -16,14 +17,21 @@ import (
 )
 
 const preferencesFileName = "org.janbuchholz.dropboxrestclient.json"
+const hashCacheFileName = "org.janbuchholz.dropboxrestclient.hashes.json"
+const transferQueueFileName = "org.janbuchholz.dropboxrestclient.queue.json"
 
 type settings struct {
 	WindowRect   unison.Rect
 	AppAuth      api.AppAuthType
 	RefreshToken string
+	Endpoints    api.EndpointsType
+	Bandwidth    api.BandwidthType
+	Workers      int // concurrent transfers, 0 selects the default
 }
 
 var _settings settings
+var dbxClient *api.Client
+var hashCache *api.HashCacheType
 
 func saveSettings() {
 	rect := mainWindow.FrameRect()
@@ -31,6 +39,9 @@ func saveSettings() {
 		WindowRect:   rect,
 		AppAuth:      _settings.AppAuth,
 		RefreshToken: _settings.RefreshToken,
+		Endpoints:    _settings.Endpoints,
+		Bandwidth:    _settings.Bandwidth,
+		Workers:      _settings.Workers,
 	}
 	j, err := json.Marshal(prefs)
 	if err == nil {
@@ -44,6 +55,7 @@ func saveSettings() {
 		}
 		fname := filepath.Join(dir, preferencesFileName)
 		_ = os.WriteFile(fname, j, 0644)
+		_ = hashCache.Save()
 	}
 	if _settings.AppAuth.AppKey != "" && _settings.AppAuth.AppSecret != "" {
 		userInfoBtn.SetEnabled(true)
@@ -59,8 +71,14 @@ func loadSettings() {
 		byteValue, _ := io.ReadAll(j)
 		_ = j.Close()
 		_ = json.Unmarshal(byteValue, &_settings)
-		api.SetConnectionData(_settings.AppAuth, _settings.RefreshToken)
 	}
+	dbxClient = api.NewClient(_settings.AppAuth, _settings.RefreshToken)
+	dbxClient.SetEndpoints(_settings.Endpoints.WithEnvironment())
+	dbxClient.SetBandwidth(_settings.Bandwidth)
+	hashCache = api.LoadHashCache(filepath.Join(dir, hashCacheFileName))
+	dbxClient.SetHashCache(hashCache)
+	_ = os.MkdirAll(dir, os.ModePerm)
+	models.OpenTransferQueue(dbxClient, filepath.Join(dir, transferQueueFileName), _settings.Workers)
 }
 
 func IsTokenPresent() bool {
@@ -9,19 +9,34 @@ package ui
 import (
 	"Dropbox_REST_Client/api"
 	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/models"
+	"Dropbox_REST_Client/transfer"
 	"fmt"
 	"github.com/richardwilkes/unison"
 	"github.com/richardwilkes/unison/enums/align"
+	"github.com/richardwilkes/unison/enums/check"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const inpTextSizeMax = 200
 const obscureRune = 0x2a
+const kibibyte = 1024
 
 var okButton *unison.Button
 var authButton *unison.Button
 var inpAppKey *unison.Field
 var inpAppSecret *unison.Field
 var inpAuthCode *unison.Field
+var inpUploadLimit *unison.Field
+var inpDownloadLimit *unison.Field
+var inpTransferLimit *unison.Field
+var chkLimitSchedule *unison.CheckBox
+var inpLimitFrom *unison.Field
+var inpLimitUntil *unison.Field
+var inpWorkers *unison.Field
 var authorizeSucceeded = false
 
 func SettingsDialogFromMenu(_ unison.MenuItem) {
@@ -59,6 +74,8 @@ func SettingsDialog() {
 		_ = dialog.Button(unison.ModalResponseCancel)
 		inpAppKey.SetText(_settings.AppAuth.AppKey)
 		inpAppSecret.SetText(_settings.AppAuth.AppSecret)
+		setBandwidthFields(_settings.Bandwidth)
+		inpWorkers.SetText(formatWorkers(_settings.Workers))
 		okButton.SetEnabled(checkOk())
 		okButton = dialog.Button(unison.ModalResponseOK)
 		okButton.ClickCallback = func() {
@@ -107,6 +124,34 @@ func newPreferencesPanel() *unison.Panel {
 	inpAuthCode.ModifiedCallback = func(before, after *unison.FieldState) {
 		inpModifiedCallback(before, after)
 	}
+	lblUploadLimit := unison.NewLabel()
+	lblUploadLimit.Font = unison.LabelFont
+	lblUploadLimit.SetTitle(assets.CapUploadLimit)
+	inpUploadLimit = newValidatedField(validLimit)
+	lblDownloadLimit := unison.NewLabel()
+	lblDownloadLimit.Font = unison.LabelFont
+	lblDownloadLimit.SetTitle(assets.CapDownloadLimit)
+	inpDownloadLimit = newValidatedField(validLimit)
+	lblTransferLimit := unison.NewLabel()
+	lblTransferLimit.Font = unison.LabelFont
+	lblTransferLimit.SetTitle(assets.CapTransferLimit)
+	inpTransferLimit = newValidatedField(validLimit)
+	chkLimitSchedule = unison.NewCheckBox()
+	chkLimitSchedule.SetTitle(assets.CapLimitFrom)
+	chkLimitSchedule.ClickCallback = func() {
+		inpLimitFrom.SetEnabled(chkLimitSchedule.State == check.On)
+		inpLimitUntil.SetEnabled(chkLimitSchedule.State == check.On)
+		okButton.SetEnabled(checkOk())
+	}
+	inpLimitFrom = newValidatedField(validTimeOfDay)
+	lblLimitUntil := unison.NewLabel()
+	lblLimitUntil.Font = unison.LabelFont
+	lblLimitUntil.SetTitle(assets.CapLimitUntil)
+	inpLimitUntil = newValidatedField(validTimeOfDay)
+	lblWorkers := unison.NewLabel()
+	lblWorkers.Font = unison.LabelFont
+	lblWorkers.SetTitle(assets.CapWorkers)
+	inpWorkers = newValidatedField(validWorkers)
 	panel.SetLayoutData(&unison.FlexLayoutData{
 		MinSize: unison.Size{Width: 300},
 		HSpan:   1,
@@ -119,6 +164,18 @@ func newPreferencesPanel() *unison.Panel {
 	panel.AddChild(inpAppSecret)
 	panel.AddChild(lblAuthCode)
 	panel.AddChild(inpAuthCode)
+	panel.AddChild(lblUploadLimit)
+	panel.AddChild(inpUploadLimit)
+	panel.AddChild(lblDownloadLimit)
+	panel.AddChild(inpDownloadLimit)
+	panel.AddChild(lblTransferLimit)
+	panel.AddChild(inpTransferLimit)
+	panel.AddChild(chkLimitSchedule)
+	panel.AddChild(inpLimitFrom)
+	panel.AddChild(lblLimitUntil)
+	panel.AddChild(inpLimitUntil)
+	panel.AddChild(lblWorkers)
+	panel.AddChild(inpWorkers)
 	panel.Pack()
 	return panel
 }
@@ -127,12 +184,21 @@ func save() {
 	_settings.WindowRect = mainWindow.FrameRect()
 	_settings.AppAuth.AppKey = inpAppKey.Text()
 	_settings.AppAuth.AppSecret = inpAppSecret.Text()
-	token, err := api.RequestRefreshToken(_settings.AppAuth, inpAuthCode.Text())
-	if err == nil {
-		_settings.RefreshToken = token
-		api.SetConnectionData(_settings.AppAuth, token)
+	_settings.Bandwidth = bandwidthFromFields()
+	dbxClient.SetBandwidth(_settings.Bandwidth) // running transfers adapt at once
+	_settings.Workers, _ = parseWorkers(inpWorkers.Text())
+	if queue := models.TransferQueue(); queue != nil {
+		queue.SetWorkers(_settings.Workers)
+	}
+	if inpAuthCode.Text() != "" {
+		ctx, cancel := models.CallContext()
+		defer cancel()
+		token, err := dbxClient.RequestRefreshToken(ctx, _settings.AppAuth, inpAuthCode.Text())
+		if err == nil {
+			_settings.RefreshToken = token
+			dbxClient.SetConnectionData(_settings.AppAuth, token)
+		}
 	}
-	fmt.Println(token)
 	saveSettings()
 }
 
@@ -142,7 +208,7 @@ func getAuthorizationCode() {
 	auth.AppSecret = inpAppSecret.Text()
 	inpAuthCode.SetText("")
 	_settings.RefreshToken = ""
-	err := api.AuthorizeApp(auth)
+	err := dbxClient.AuthorizeApp(auth)
 	if err == nil {
 		inpAuthCode.SetEnabled(true)
 		authorizeSucceeded = true
@@ -154,8 +220,121 @@ func inpModifiedCallback(_, _ *unison.FieldState) {
 	authButton.SetEnabled(checkAuth())
 }
 
+// checkOk -the bandwidth can be changed without authorizing again, an entered authorization code needs a
+// successful authorization
 func checkOk() bool {
-	return inpAppSecret.Text() != "" && inpAppKey.Text() != "" && inpAuthCode.Text() != "" && authorizeSucceeded
+	return inpAppSecret.Text() != "" && inpAppKey.Text() != "" && (inpAuthCode.Text() == "" || authorizeSucceeded) &&
+		validLimit(inpUploadLimit.Text()) && validLimit(inpDownloadLimit.Text()) &&
+		validLimit(inpTransferLimit.Text()) && (chkLimitSchedule.State != check.On ||
+		validTimeOfDay(inpLimitFrom.Text()) && validTimeOfDay(inpLimitUntil.Text())) && validWorkers(inpWorkers.Text())
+}
+
+// newValidatedField -input field whose text is checked by valid, changes update the dialog buttons
+func newValidatedField(valid func(text string) bool) *unison.Field {
+	field := unison.NewField()
+	field.Font = unison.FieldFont
+	field.MinimumTextWidth = inpTextSizeMax
+	field.ValidateCallback = func() bool { return valid(field.Text()) }
+	field.ModifiedCallback = func(before, after *unison.FieldState) {
+		inpModifiedCallback(before, after)
+	}
+	return field
+}
+
+func setBandwidthFields(bandwidth api.BandwidthType) {
+	inpUploadLimit.SetText(formatLimit(bandwidth.Upload))
+	inpDownloadLimit.SetText(formatLimit(bandwidth.Download))
+	inpTransferLimit.SetText(formatLimit(bandwidth.PerTransfer))
+	chkLimitSchedule.State = check.Off
+	if bandwidth.Scheduled {
+		chkLimitSchedule.State = check.On
+	}
+	inpLimitFrom.SetText(formatTimeOfDay(bandwidth.From))
+	inpLimitUntil.SetText(formatTimeOfDay(bandwidth.To))
+	inpLimitFrom.SetEnabled(bandwidth.Scheduled)
+	inpLimitUntil.SetEnabled(bandwidth.Scheduled)
+}
+
+// bandwidthFromFields -limits entered in KiB/s, empty or 0 is unlimited
+func bandwidthFromFields() api.BandwidthType {
+	var bandwidth api.BandwidthType
+	bandwidth.Upload, _ = parseLimit(inpUploadLimit.Text())
+	bandwidth.Download, _ = parseLimit(inpDownloadLimit.Text())
+	bandwidth.PerTransfer, _ = parseLimit(inpTransferLimit.Text())
+	bandwidth.Scheduled = chkLimitSchedule.State == check.On
+	bandwidth.From, _ = parseTimeOfDay(inpLimitFrom.Text())
+	bandwidth.To, _ = parseTimeOfDay(inpLimitUntil.Text())
+	return bandwidth
+}
+
+func parseLimit(text string) (int64, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(text, 10, 64)
+	if err == nil && (limit < 0 || limit > math.MaxInt64/kibibyte) {
+		err = strconv.ErrRange
+	}
+	if err != nil {
+		return 0, err
+	}
+	return limit * kibibyte, nil
+}
+
+func validLimit(text string) bool {
+	_, err := parseLimit(text)
+	return err == nil
+}
+
+func formatLimit(limit int64) string {
+	if limit <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(limit/kibibyte, 10)
+}
+
+// parseWorkers -number of concurrent transfers, empty is the default
+func parseWorkers(text string) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	workers, err := strconv.Atoi(text)
+	if err == nil && (workers < 1 || workers > transfer.MaxWorkers) {
+		err = strconv.ErrRange
+	}
+	return workers, err
+}
+
+func validWorkers(text string) bool {
+	_, err := parseWorkers(text)
+	return err == nil
+}
+
+func formatWorkers(workers int) string {
+	if workers <= 0 {
+		workers = transfer.DefaultWorkers
+	}
+	return strconv.Itoa(workers)
+}
+
+// parseTimeOfDay -"hh:mm" to minutes since midnight
+func parseTimeOfDay(text string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(text))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validTimeOfDay(text string) bool {
+	_, err := parseTimeOfDay(text)
+	return err == nil
+}
+
+func formatTimeOfDay(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
 }
 
 func checkAuth() bool {
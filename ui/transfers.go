@@ -0,0 +1,161 @@
+// ---------------------------------------------------------------------------------------------------------------------
+// (w) 2024 by Jan Buchholz
+// Transfer queue window, using Unison library (c) Richard A. Wilkes
+// https://github.com/richardwilkes/unison
+// ---------------------------------------------------------------------------------------------------------------------
+
+package ui
+
+import (
+	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/models"
+	"Dropbox_REST_Client/transfer"
+	"fmt"
+	"github.com/richardwilkes/toolbox/errs"
+	"github.com/richardwilkes/unison"
+	"github.com/richardwilkes/unison/enums/align"
+	"github.com/richardwilkes/unison/enums/behavior"
+	"slices"
+)
+
+const (
+	transfersWidth  float32 = 600
+	transfersHeight float32 = 300
+)
+
+var transfersWindow *unison.Window
+var transfersList *unison.List[transferRowType]
+
+type transferRowType struct {
+	task transfer.TaskType
+}
+
+func (r transferRowType) String() string {
+	var state string
+	switch r.task.State {
+	case transfer.Queued:
+		state = assets.TxtStateQueued
+	case transfer.Running:
+		state = assets.TxtStateRunning
+	case transfer.Paused:
+		state = assets.TxtStatePaused
+	case transfer.Suspended:
+		state = assets.TxtStateSuspended
+	case transfer.Done:
+		state = assets.TxtStateDone
+	case transfer.Failed:
+		state = assets.TxtStateFailed
+	case transfer.Cancelled:
+		state = assets.TxtStateCancelled
+	}
+	direction := "↑"
+	if r.task.Kind == transfer.Download {
+		direction = "↓"
+	}
+	text := fmt.Sprintf("%s %s  %s  (%s)", direction, r.task.Name(), models.ConvertBytes(r.task.Size), state)
+	if r.task.Err != nil {
+		text += ": " + r.task.Err.Error()
+	}
+	return text
+}
+
+// TransfersWindow -list of the queued transfers, they can be paused, resumed or cancelled
+func TransfersWindow() {
+	if transfersWindow != nil {
+		transfersWindow.ToFront()
+		return
+	}
+	wnd, err := unison.NewWindow(assets.CapTransfers)
+	if err != nil {
+		errs.Log(err)
+		return
+	}
+	content := wnd.Content()
+	content.SetBorder(unison.NewEmptyBorder(unison.NewUniformInsets(5)))
+	content.SetLayout(&unison.FlexLayout{
+		Columns:  1,
+		HSpacing: 1,
+		VSpacing: 5,
+	})
+	transfersList = unison.NewList[transferRowType]()
+	transfersList.SetAllowMultipleSelection(true)
+	scroller := unison.NewScrollPanel()
+	scroller.SetContent(transfersList, behavior.Fill, behavior.Fill)
+	scroller.SetLayoutData(&unison.FlexLayoutData{
+		SizeHint: unison.NewSize(transfersWidth, transfersHeight),
+		HAlign:   align.Fill,
+		VAlign:   align.Fill,
+		HGrab:    true,
+		VGrab:    true,
+	})
+	content.AddChild(scroller)
+	buttons := unison.NewPanel()
+	buttons.SetLayout(&unison.FlowLayout{
+		HSpacing: 5,
+		VSpacing: unison.StdVSpacing,
+	})
+	queue := models.TransferQueue()
+	addTransfersButton(buttons, assets.CapPause, func() {
+		if ids := selectedTransfers(); len(ids) > 0 {
+			queue.Pause(ids...)
+		}
+	})
+	addTransfersButton(buttons, assets.CapResume, func() {
+		if ids := selectedTransfers(); len(ids) > 0 {
+			queue.Resume(ids...)
+		}
+	})
+	addTransfersButton(buttons, assets.CapCancel, func() {
+		if ids := selectedTransfers(); len(ids) > 0 {
+			queue.Cancel(ids...)
+		}
+	})
+	addTransfersButton(buttons, assets.CapPauseAll, func() { queue.Pause() })
+	addTransfersButton(buttons, assets.CapResumeAll, func() { queue.Resume() })
+	addTransfersButton(buttons, assets.CapCancelAll, func() { queue.Cancel() })
+	content.AddChild(buttons)
+	wnd.WillCloseCallback = func() {
+		models.TransfersChangedCallback = nil
+		transfersWindow, transfersList = nil, nil
+	}
+	models.TransfersChangedCallback = refreshTransfersList
+	transfersWindow = wnd
+	refreshTransfersList()
+	wnd.Pack()
+	wnd.ToFront()
+}
+
+func addTransfersButton(panel *unison.Panel, title string, action func()) {
+	button := unison.NewButton()
+	button.Font = unison.LabelFont.Face().Font(toolbarFontSize)
+	button.SetTitle(title)
+	button.SetFocusable(false)
+	button.ClickCallback = action
+	panel.AddChild(button)
+}
+
+// selectedTransfers -ids of the selected tasks
+func selectedTransfers() []int64 {
+	var ids []int64
+	for i := 0; i < transfersList.Count(); i++ {
+		if transfersList.Selection.State(i) {
+			ids = append(ids, transfersList.DataAtIndex(i).task.Id)
+		}
+	}
+	return ids
+}
+
+// refreshTransfersList -show the current tasks, the selection is kept
+func refreshTransfersList() {
+	var selected []int
+	ids := selectedTransfers()
+	transfersList.Clear()
+	for i, task := range models.TransferQueue().Tasks() {
+		transfersList.Append(transferRowType{task})
+		if slices.Contains(ids, task.Id) {
+			selected = append(selected, i)
+		}
+	}
+	transfersList.Select(false, selected...)
+	transfersList.MarkForLayoutAndRedraw()
+}
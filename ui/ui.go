@@ -8,6 +8,7 @@ package ui
 
 import (
 	"Dropbox_REST_Client/assets"
+	"Dropbox_REST_Client/dialogs"
 	"Dropbox_REST_Client/models"
 	"github.com/richardwilkes/unison"
 )
@@ -19,6 +20,7 @@ const (
 
 var mainWindow *unison.Window
 var mainContent *unison.Panel
+var quitWhenIdle bool // close the main window when the last transfer has ended
 
 func NewMainWindow() error {
 	var err error
@@ -28,6 +30,21 @@ func NewMainWindow() error {
 	}
 	installDefaultMenus(mainWindow)
 	loadSettings()
+	models.AuthorizationRequiredCallback = SettingsDialog
+	models.OperationStateCallback = func(running bool) {
+		cancelBtn.SetEnabled(running)
+		if !running {
+			lblRunning.SetTitle("") // clears the progress of async jobs
+		}
+	}
+	models.JobProgressCallback = updateJobProgress
+	models.ViewModeCallback = updateModeButtons
+	models.SearchDoneCallback = searchDone
+	models.TransfersIdleCallback = func() {
+		if quitWhenIdle {
+			mainWindow.AttemptClose()
+		}
+	}
 	mainContent = mainWindow.Content()
 	mainContent.SetBorder(unison.NewEmptyBorder(unison.NewUniformInsets(5)))
 	mainContent.SetLayout(&unison.FlexLayout{
@@ -37,6 +54,7 @@ func NewMainWindow() error {
 	})
 	mainContent.AddChild(createToolbarPanel())
 	mainContent.AddChild(createTablePanel())
+	mainContent.AddChild(createProgressPanel())
 	mainWindow.Pack()
 	// Set MainWindow size & position
 	rect := _settings.WindowRect
@@ -70,6 +88,9 @@ func installCallbacks() {
 	mainWindow.MinMaxContentSizeCallback = func() (minSize, maxSize unison.Size) {
 		return windowMinMaxResizeCallback()
 	}
+	mainWindow.AllowCloseCallback = func() bool {
+		return mainWindowAllowClose()
+	}
 	mainWindow.WillCloseCallback = func() {
 		mainWindowWillClose()
 	}
@@ -84,11 +105,29 @@ func windowMinMaxResizeCallback() (minSize, maxSize unison.Size) {
 	return _min, _max
 }
 
+// mainWindowAllowClose -running transfers are either finished before the window closes or suspended
+func mainWindowAllowClose() bool {
+	if !models.TransfersBusy() {
+		return true
+	}
+	if quitWhenIdle {
+		models.SuspendTransfers() // closed again while waiting for the transfers
+		return true
+	}
+	switch dialogs.DialogToQueryQuitWithTransfers() {
+	case dialogs.QuitFinish:
+		quitWhenIdle = true
+	case dialogs.QuitSuspend:
+		models.SuspendTransfers()
+		return true
+	}
+	return false
+}
+
 func mainWindowWillClose() {
 	saveSettings()
 }
 
 func AllowQuitCallback() bool {
-	mainWindow.AttemptClose()
-	return true
+	return mainWindow.AttemptClose()
 }
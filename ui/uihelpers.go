@@ -7,7 +7,6 @@
 package ui
 
 import (
-	"Dropbox_REST_Client/api"
 	"Dropbox_REST_Client/assets"
 	"Dropbox_REST_Client/dialogs"
 	"Dropbox_REST_Client/models"
@@ -22,6 +21,14 @@ const (
 	toolbarFontSize  float32 = 9
 )
 
+const (
+	pruneHashCacheItemID = unison.UserBaseID + iota
+	transfersItemID
+	versionHistoryItemID
+	revealItemID
+	moveToItemID
+)
+
 var settingsBtn *unison.Button
 var userInfoBtn *unison.Button
 var refreshBtn *unison.Button
@@ -29,6 +36,9 @@ var addFolderBtn *unison.Button
 var deleteBtn *unison.Button
 var uploadBtn *unison.Button
 var downloadBtn *unison.Button
+var restoreBtn *unison.Button
+var trashBtn *unison.Button
+var cancelBtn *unison.Button
 var btnSelection *unison.Button
 var tableContent *unison.Panel
 
@@ -111,6 +121,27 @@ func createToolbarPanel() *unison.Panel {
 		panel.AddChild(downloadBtn)
 		downloadBtn.ClickCallback = func() { downloadItems() }
 	}
+	restoreBtn, err = createButton(assets.CapRestore, assets.IconRestore)
+	if err == nil {
+		restoreBtn.SetEnabled(false)
+		restoreBtn.SetFocusable(false)
+		panel.AddChild(restoreBtn)
+		restoreBtn.ClickCallback = func() { restoreItems() }
+	}
+	trashBtn, err = createButton(assets.CapTrash, assets.IconTrash)
+	if err == nil {
+		trashBtn.SetEnabled(true)
+		trashBtn.SetFocusable(false)
+		panel.AddChild(trashBtn)
+		trashBtn.ClickCallback = func() { toggleTrash() }
+	}
+	cancelBtn, err = createButton(assets.CapCancel, assets.IconCancel)
+	if err == nil {
+		cancelBtn.SetEnabled(false)
+		cancelBtn.SetFocusable(false)
+		panel.AddChild(cancelBtn)
+		cancelBtn.ClickCallback = func() { cancelOperation() }
+	}
 	createSpacer(10, panel)
 	lblMode := unison.NewLabel()
 	lblMode.Font = unison.LabelFont.Face().Font(toolbarFontSize)
@@ -122,14 +153,17 @@ func createToolbarPanel() *unison.Panel {
 	popMode.Font = unison.LabelFont.Face().Font(toolbarFontSize)
 	popMode.AddItem(assets.OptUpdate)
 	popMode.AddItem(assets.OptSkip)
+	popMode.AddItem(assets.OptKeepBoth)
 	popMode.SetFocusable(false)
 	popMode.SelectionChangedCallback = func(popup *unison.PopupMenu[string]) {
 		item, _ := popup.Selected()
-		api.SetExistingFilesStrategy(item)
+		dbxClient.SetExistingFilesStrategy(item)
 	}
 	popMode.SelectIndex(0)
 	panel.AddChild(popMode)
 	createSpacer(30, panel)
+	addSearchControls(panel)
+	createSpacer(30, panel)
 	btnSelection, err = createButton(assets.CapClearSelection, assets.IconClear)
 	if err == nil {
 		btnSelection.SetEnabled(true)
@@ -142,9 +176,42 @@ func createToolbarPanel() *unison.Panel {
 	return panel
 }
 
+// updateModeButtons -adapt the toolbar to the view shown, the Dropbox folders, the deleted entries or
+// search results
+func updateModeButtons() {
+	trash := models.TrashMode()
+	addFolderBtn.SetEnabled(!trash && !models.SearchMode())
+	uploadBtn.SetEnabled(!trash && !models.SearchMode())
+	downloadBtn.SetEnabled(!trash)
+	restoreBtn.SetEnabled(trash)
+	deleteBtn.SetEnabled(!trash || models.CanDeletePermanently())
+	if trash {
+		deleteBtn.SetTitle(assets.CapDeletePermanently)
+		trashBtn.SetTitle(assets.CapFiles)
+	} else {
+		deleteBtn.SetTitle(assets.CapDelete)
+		trashBtn.SetTitle(assets.CapTrash)
+	}
+	deleteBtn.Parent().MarkForLayoutAndRedraw()
+}
+
 func installDefaultMenus(wnd *unison.Window) {
 	unison.DefaultMenuFactory().BarForWindow(wnd, func(m unison.Menu) {
 		unison.InsertStdMenus(m, dialogs.AboutDialog, SettingsDialogFromMenu, nil)
+		if fileMenu := m.Menu(unison.FileMenuID); fileMenu != nil {
+			inSearch := func(unison.MenuItem) bool { return models.SearchMode() }
+			fileMenu.InsertItem(0, m.Factory().NewItem(versionHistoryItemID, assets.CapVersionHistory,
+				unison.KeyBinding{}, nil, func(unison.MenuItem) { versionHistory() }))
+			fileMenu.InsertItem(1, m.Factory().NewItem(revealItemID, assets.CapRevealInFolders,
+				unison.KeyBinding{}, inSearch, func(unison.MenuItem) { revealSearchResult() }))
+			fileMenu.InsertItem(2, m.Factory().NewItem(moveToItemID, assets.CapMoveTo,
+				unison.KeyBinding{}, inSearch, func(unison.MenuItem) { moveSearchResults() }))
+			fileMenu.InsertItem(3, m.Factory().NewItem(transfersItemID, assets.CapTransfers,
+				unison.KeyBinding{}, nil, func(unison.MenuItem) { TransfersWindow() }))
+			fileMenu.InsertItem(4, m.Factory().NewItem(pruneHashCacheItemID, assets.CapPruneHashCache,
+				unison.KeyBinding{}, nil, func(unison.MenuItem) { pruneHashCache() }))
+			fileMenu.InsertSeparator(5, false)
+		}
 	})
 }
 
@@ -167,7 +234,7 @@ func createTablePanel() *unison.Panel {
 }
 
 func newFileSystemTable(content *unison.Panel) {
-	table, header := models.NewFileSystemTable()
+	table, header := models.NewFileSystemTable(dbxClient)
 	header.SetLayoutData(&unison.FlexLayoutData{
 		HAlign: align.Fill,
 		VAlign: align.Fill,